@@ -1,20 +1,37 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/blocklist"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/config"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/config/db"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/geoip"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/handler"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/metrics"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/middleware"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout — сколько ждать завершения активных запросов после сигнала
+// остановки.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var rep repository.URLRepository
 	if err := logger.Initialize("info"); err != nil {
@@ -24,8 +41,22 @@ func main() {
 
 	cfg := config.InitConfig()
 
+	// После SIGINT или SIGTERM main возвращается штатно, чтобы отложенные
+	// Close успели дописать счётчики переходов и закрыть соединения.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Initialize(context.Background(), tracing.Config{
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.TraceEndpoint,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		logger.Log.Fatal("Ошибка инициализации трассировки", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
 	var dbConn *sql.DB
-	var err error
 	if cfg.DatabaseDSN != "" {
 		dbConn, err = db.Initialize(cfg.DatabaseDSN)
 		if err != nil {
@@ -37,34 +68,202 @@ func main() {
 			logger.Log.Fatal("Ошибка создания схемы DB", zap.Error(err))
 		}
 		
+		if err := metrics.RegisterDBStats(dbConn); err != nil {
+			logger.Log.Fatal("Ошибка регистрации метрик DB", zap.Error(err))
+		}
+
 		logger.Log.Info("DB connection established")
-		rep = repository.NewDBRepository(dbConn)
+		rep = repository.NewInstrumentedRepository(repository.NewDBRepository(dbConn), "postgres")
 	} else if cfg.FileStoragePath != "" {
 		fileRepo, err := repository.NewFileRepository(cfg.FileStoragePath)
 		if err != nil {
 			logger.Log.Fatal("Ошибка инициализации файлового репозитория", zap.Error(err))
 		}
 		defer fileRepo.Close()
-		rep = fileRepo
+		rep = repository.NewInstrumentedRepository(fileRepo, "file")
 	} else {
-		rep = repository.NewMemoryRepository()
+		rep = repository.NewInstrumentedRepository(repository.NewMemoryRepository(), "memory")
+	}
+
+	validator := service.NewURLValidator(strings.Split(cfg.AllowedSchemes, ","), cfg.StripTrackingParams)
+	serviceOpts := []service.Option{service.WithURLValidator(validator)}
+
+	var blocked *blocklist.Blocklist
+	if cfg.BlocklistFiles != "" {
+		blocked, err = blocklist.New(strings.Split(cfg.BlocklistFiles, ","))
+		if err != nil {
+			logger.Log.Fatal("Ошибка загрузки блок-листа", zap.Error(err))
+		}
+		serviceOpts = append(serviceOpts, service.WithScreener(blocked))
 	}
 
-	serv := service.NewShortenerService(rep)
-	hndl := handler.NewHandler(serv, cfg.BaseURL, dbConn)
+	serv := service.NewShortenerService(rep, serviceOpts...)
+
+	if blocked != nil {
+		applyBlocklist := func() {
+			disabled, enabled, err := serv.ApplyBlocklist(context.Background())
+			if err != nil {
+				logger.Log.Error("Не удалось применить блок-лист к ссылкам", zap.Error(err))
+				return
+			}
+			logger.Log.Info("Блок-лист применён", zap.Int("disabled", disabled), zap.Int("enabled", enabled))
+		}
+		applyBlocklist()
+		go blocked.Watch(ctx, cfg.BlocklistReloadInterval, applyBlocklist)
+	}
+	if !model.ValidRedirectType(cfg.RedirectType) {
+		logger.Log.Fatal("Неизвестный способ перенаправления", zap.String("redirect_type", cfg.RedirectType))
+	}
+	resolver, err := middleware.NewClientIPResolver(strings.Split(cfg.TrustedProxies, ","))
+	if err != nil {
+		logger.Log.Fatal("Некорректный список доверенных прокси", zap.Error(err))
+	}
+	var geo *geoip.DB
+	if cfg.GeoIPFile != "" {
+		geo, err = geoip.Open(cfg.GeoIPFile)
+		if err != nil {
+			logger.Log.Fatal("Не удалось загрузить базу GeoIP", zap.String("path", cfg.GeoIPFile), zap.Error(err))
+		}
+		logger.Log.Info("База GeoIP загружена", zap.Int("ranges", geo.Len()))
+	}
+	signer := auth.NewSigner(cfg.SecretKey)
+	templates, err := handler.LoadTemplates(cfg.TemplateDir)
+	if err != nil {
+		logger.Log.Fatal("Не удалось загрузить шаблоны страниц", zap.String("dir", cfg.TemplateDir), zap.Error(err))
+	}
+	hndl := handler.NewHandler(serv, cfg.BaseURL, dbConn,
+		handler.WithMaxBodySize(cfg.MaxBodySize),
+		handler.WithSigner(signer),
+		handler.WithUnlockTTL(cfg.UnlockTTL),
+		handler.WithTemplates(templates),
+		handler.WithDefaultRedirect(cfg.RedirectType),
+		handler.WithConfig(cfg.Redacted()),
+		handler.WithCountryFunc(func(r *http.Request) string {
+			return geo.Country(resolver.Resolve(r))
+		}),
+	)
 
 	mux := chi.NewRouter()
+	mux.Use(middleware.RequestID)
+	mux.Use(middleware.Tracing)
 	mux.Use(middleware.RequestLogger)
-	mux.Use(middleware.GzipMiddleware)
-	mux.Post("/", hndl.Post)
-	mux.Get("/{id}", hndl.Get)
-	mux.Post("/api/shorten", hndl.PostShorten)
-	mux.Get("/ping", hndl.GetPing)
+	mux.Use(middleware.NewGzipMiddleware(middleware.CompressionConfig{
+		MinSize:             cfg.CompressMinSize,
+		MaxCompressedSize:   cfg.MaxCompressedBodySize,
+		MaxDecompressedSize: cfg.MaxBodySize,
+		MaxRatio:            cfg.MaxCompressionRatio,
+	}))
+	clientKey := middleware.ClientKey(resolver)
+	createLimiter := middleware.NewRateLimiter(cfg.CreateRateLimit, cfg.CreateBurst, cfg.RateLimitEntries, clientKey)
+	redirectLimiter := middleware.NewRateLimiter(cfg.RedirectRateLimit, cfg.RedirectBurst, cfg.RateLimitEntries, clientKey)
+	unlockLimiter := middleware.NewRateLimiter(cfg.UnlockRate, cfg.UnlockBurst, cfg.RateLimitEntries, func(r *http.Request) string {
+		return clientKey(r) + "|" + chi.URLParam(r, "id")
+	})
+
+	keyAuth := middleware.APIKeyAuth(serv)
+	var admins []string
+	if cfg.AdminUsers != "" {
+		admins = strings.Split(cfg.AdminUsers, ",")
+	}
+
+	mux.Group(func(r chi.Router) {
+		r.Use(keyAuth)
+		r.Use(middleware.Auth(signer, admins...))
+
+		canWrite := middleware.RequireScope(auth.ScopeLinksWrite)
+		canRead := middleware.RequireScope(auth.ScopeLinksRead)
+		canStats := middleware.RequireScope(auth.ScopeStatsRead)
+		r.With(createLimiter.Middleware, canWrite).Post("/", hndl.Post)
+		r.With(createLimiter.Middleware, canWrite).Post("/api/shorten", hndl.PostShorten)
+		r.With(createLimiter.Middleware, canWrite).Patch("/api/urls/{id}", hndl.PatchURL)
+		r.With(canWrite).Delete("/api/urls/{id}", hndl.DeleteURL)
+		r.With(canRead).Get("/api/urls/{id}/history", hndl.GetHistory)
+		r.With(canStats).Get("/api/urls/{id}/stats", hndl.GetStats)
+		r.With(canRead).Get("/api/user/urls", hndl.ListURLs)
+		r.With(canWrite).Post("/api/urls/{id}/tags", hndl.PostTags)
+		r.With(canWrite).Delete("/api/urls/{id}/tags/{tag}", hndl.DeleteTag)
+		r.With(canRead).Get("/api/user/tags", hndl.ListTags)
+		r.With(canStats).Get("/api/user/tags/{tag}/stats", hndl.GetTagStats)
+
+		r.With(createLimiter.Middleware).Post("/api/keys", hndl.PostAPIKey)
+		r.Get("/api/keys", hndl.ListAPIKeys)
+		r.Delete("/api/keys/{keyID}", hndl.DeleteAPIKey)
+	})
+	mux.Route("/dashboard", func(r chi.Router) {
+		r.Handle("/static/*", handler.DashboardStatic())
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Auth(signer, admins...))
+			r.Use(middleware.CSRF(signer))
 
-	logger.Log.Info("Starting server", zap.String("address", cfg.ServerAddress))
+			r.Get("/", hndl.Dashboard)
+			r.With(createLimiter.Middleware).Post("/links", hndl.DashboardCreate)
+			r.Get("/links/{id}", hndl.DashboardLink)
+			r.Post("/links/{id}", hndl.DashboardUpdate)
+			r.Post("/links/{id}/delete", hndl.DashboardDelete)
+			r.Post("/links/{id}/tags", hndl.DashboardAddTags)
+			r.Post("/links/{id}/tags/remove", hndl.DashboardRemoveTag)
+		})
+	})
+	mux.With(keyAuth, redirectLimiter.Middleware).Get("/{id}", hndl.Get)
+	mux.With(keyAuth, redirectLimiter.Middleware).Head("/{id}", hndl.Get)
+	mux.With(keyAuth, unlockLimiter.Middleware).Post("/{id}", hndl.PostUnlock)
+	mux.With(keyAuth, redirectLimiter.Middleware).Get("/api/urls/{id}/qr", hndl.GetQR)
 
-	err = http.ListenAndServe(cfg.ServerAddress, mux)
+	internalAccess, err := middleware.TrustedSubnetOrAdminKey(cfg.TrustedSubnet, resolver)
 	if err != nil {
-		logger.Log.Fatal("Сервер упал", zap.Error(err))
+		logger.Log.Fatal("Некорректная доверенная подсеть", zap.Error(err))
+	}
+	mux.Route("/api/internal", func(r chi.Router) {
+		r.Use(keyAuth)
+		r.Use(internalAccess)
+
+		r.Get("/stats", hndl.InternalStats)
+		r.Get("/urls/{id}", hndl.InternalGetURL)
+		r.Post("/urls/{id}/disable", hndl.InternalDisableURL)
+		r.Post("/urls/{id}/enable", hndl.InternalEnableURL)
+		r.Delete("/users/{userID}/urls", hndl.InternalDeleteUserURLs)
+		r.Get("/config", hndl.InternalConfig)
+	})
+
+	mux.Get("/ping", hndl.GetPing)
+
+	servers := []*http.Server{{Addr: cfg.ServerAddress, Handler: mux}}
+
+	if cfg.MetricsAddress != "" {
+		metricsMux := chi.NewRouter()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer := &http.Server{Addr: cfg.MetricsAddress, Handler: metricsMux}
+		servers = append(servers, metricsServer)
+
+		go func() {
+			logger.Log.Info("Starting metrics server", zap.String("address", cfg.MetricsAddress))
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Log.Fatal("Сервер метрик упал", zap.Error(err))
+			}
+		}()
+	} else {
+		trusted, err := middleware.TrustedSubnet(cfg.TrustedSubnet, resolver)
+		if err != nil {
+			logger.Log.Fatal("Некорректная доверенная подсеть", zap.Error(err))
+		}
+		mux.With(trusted).Handle("/metrics", metrics.Handler())
+	}
+
+	go func() {
+		logger.Log.Info("Starting server", zap.String("address", cfg.ServerAddress))
+		if err := servers[0].ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Log.Fatal("Сервер упал", zap.Error(err))
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Log.Info("Остановка сервера")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("Сервер не остановился штатно", zap.Error(err))
+		}
 	}
 }
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Ключ имеет вид "sk_<id>_<secret>": по id запись ищется в хранилище, а
+// secret сверяется с сохранённым хешем. Сам ключ нигде не хранится.
+const apiKeyPrefix = "sk_"
+
+// NewAPIKey создаёт ключ и возвращает его идентификатор, сам ключ для
+// передачи клиенту и хеш секрета для хранения.
+func NewAPIKey() (id, key, hash string, err error) {
+	buf := make([]byte, 6+32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	id = hex.EncodeToString(buf[:6])
+	secret := base64.RawURLEncoding.EncodeToString(buf[6:])
+	return id, apiKeyPrefix + id + "_" + secret, HashSecret(secret), nil
+}
+
+// ParseAPIKey разбирает ключ на идентификатор и секрет.
+func ParseAPIKey(key string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// HashSecret возвращает хеш секрета ключа. Секрет случаен и достаточно
+// длинный, поэтому медленный хеш вроде bcrypt здесь не нужен.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func SecretMatches(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
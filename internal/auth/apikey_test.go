@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	id, key, hash, err := NewAPIKey()
+	require.NoError(t, err)
+
+	parsedID, secret, ok := ParseAPIKey(key)
+	require.True(t, ok)
+	assert.Equal(t, id, parsedID)
+	assert.True(t, SecretMatches(secret, hash))
+	assert.False(t, SecretMatches(secret+"x", hash))
+	assert.NotContains(t, hash, secret)
+
+	for _, bad := range []string{"", "sk_", "sk_abc", "sk__secret", "pk_abc_secret"} {
+		_, _, ok := ParseAPIKey(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, HasScope(ctx, ScopeLinksRead))
+
+	ctx = WithScopes(ctx, []string{ScopeLinksRead})
+	assert.True(t, HasScope(ctx, ScopeLinksRead))
+	assert.False(t, HasScope(ctx, ScopeLinksWrite))
+
+	ctx = WithScopes(ctx, []string{ScopeAdmin})
+	assert.True(t, HasScope(ctx, ScopeStatsRead))
+}
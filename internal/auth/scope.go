@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Права доступа API-ключей. ScopeAdmin включает все остальные.
+const (
+	ScopeLinksWrite = "links:write"
+	ScopeLinksRead  = "links:read"
+	ScopeStatsRead  = "stats:read"
+	ScopeAdmin      = "admin"
+)
+
+// SessionScopes — права пользователя, вошедшего по cookie.
+var SessionScopes = []string{ScopeLinksWrite, ScopeLinksRead, ScopeStatsRead}
+
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeLinksWrite, ScopeLinksRead, ScopeStatsRead, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+type scopesKey struct{}
+
+type apiKeyIDKey struct{}
+
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// ScopesFromContext возвращает права запроса; ok ложно, если запрос никак не
+// аутентифицирован.
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesKey{}).([]string)
+	return scopes, ok
+}
+
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, _ := ScopesFromContext(ctx)
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, ScopeAdmin)
+}
+
+// WithAPIKeyID отмечает, что запрос аутентифицирован API-ключом id.
+func WithAPIKeyID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, apiKeyIDKey{}, id)
+}
+
+func APIKeyIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(secret string) *Signer {
+	if secret == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return &Signer{key: key}
+	}
+	return &Signer{key: []byte(secret)}
+}
+
+func (s *Signer) mac(value string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (s *Signer) Sign(value string) string {
+	return value + "." + s.mac(value)
+}
+
+func (s *Signer) Verify(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+
+	value, sig := signed[:i], signed[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.mac(value))) {
+		return "", false
+	}
+	return value, true
+}
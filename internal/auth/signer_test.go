@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	s := NewSigner("secret")
+
+	signed := s.Sign("user-42")
+	value, ok := s.Verify(signed)
+	assert.True(t, ok)
+	assert.Equal(t, "user-42", value)
+
+	_, ok = s.Verify("user-43" + signed[len("user-42"):])
+	assert.False(t, ok, "подменённое значение не должно проходить проверку")
+
+	_, ok = NewSigner("other").Verify(signed)
+	assert.False(t, ok, "подпись другим ключом не должна проходить проверку")
+
+	_, ok = s.Verify("no-signature")
+	assert.False(t, ok)
+}
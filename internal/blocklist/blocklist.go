@@ -0,0 +1,205 @@
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const regexPrefix = "re:"
+
+// Каждая строка файла — отдельное правило:
+//
+//	example.com        точное совпадение домена
+//	*.example.com      любой поддомен example.com
+//	re:^phish\d+\.     регулярное выражение для хоста
+//
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+type rules struct {
+	domains  map[string]struct{}
+	suffixes []string
+	patterns []*regexp.Regexp
+}
+
+type Blocklist struct {
+	files []string
+
+	mu      sync.RWMutex
+	rules   rules
+	modTime map[string]time.Time
+}
+
+func New(files []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, file := range files {
+		if file = strings.TrimSpace(file); file != "" {
+			b.files = append(b.files, file)
+		}
+	}
+
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func parseFile(path string, r *rules) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, regexPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(line, regexPrefix))
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+			r.patterns = append(r.patterns, re)
+		case strings.HasPrefix(line, "*."):
+			domain, err := normalizeDomain(line[2:])
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+			r.suffixes = append(r.suffixes, "."+domain)
+		default:
+			domain, err := normalizeDomain(line)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+			r.domains[domain] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// normalizeDomain приводит домен к тому же виду, что и валидатор адресов:
+// национальные домены хранятся в punycode, иначе "пример.рф" в блок-листе не
+// совпал бы с хостом "xn--e1afmkfd.xn--p1ai".
+func normalizeDomain(domain string) (string, error) {
+	return idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+}
+
+// Reload перечитывает файлы, если хотя бы один из них изменился, и сообщает,
+// были ли применены новые правила.
+func (b *Blocklist) Reload() (bool, error) {
+	modTime := make(map[string]time.Time, len(b.files))
+	for _, path := range b.files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		modTime[path] = info.ModTime()
+	}
+
+	b.mu.RLock()
+	changed := b.modTime == nil
+	for path, t := range modTime {
+		if !b.modTime[path].Equal(t) {
+			changed = true
+		}
+	}
+	b.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	r := rules{domains: make(map[string]struct{})}
+	for _, path := range b.files {
+		if err := parseFile(path, &r); err != nil {
+			return false, err
+		}
+	}
+
+	b.mu.Lock()
+	b.rules = r
+	b.modTime = modTime
+	b.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch периодически проверяет файлы и вызывает onReload после применения
+// изменённых правил. Ошибки разбора не сбрасывают ранее загруженные правила.
+// Неположительный interval отключает перечитывание.
+func (b *Blocklist) Watch(ctx context.Context, interval time.Duration, onReload func()) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := b.Reload()
+			if err != nil {
+				logger.Log.Error("Не удалось перечитать блок-лист", zap.Error(err))
+				continue
+			}
+			if reloaded {
+				logger.Log.Info("Блок-лист перечитан")
+				if onReload != nil {
+					onReload()
+				}
+			}
+		}
+	}
+}
+
+func (b *Blocklist) MatchHost(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.rules.domains[host]; ok {
+		return host, true
+	}
+
+	for _, suffix := range b.rules.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return "*" + suffix, true
+		}
+	}
+
+	for _, re := range b.rules.patterns {
+		if re.MatchString(host) {
+			return regexPrefix + re.String(), true
+		}
+	}
+
+	return "", false
+}
+
+func (b *Blocklist) Match(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return b.MatchHost(u.Hostname())
+}
@@ -0,0 +1,107 @@
+package blocklist
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRules(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestBlocklistMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, path, `
+# точные домены
+evil.example
+*.phishing.test
+re:^login-[a-z]+\.bank\.test$
+# национальные домены сравниваются в punycode
+Пример.рф
+*.фишинг.test
+`, time.Now())
+
+	b, err := New([]string{path})
+	require.NoError(t, err)
+
+	type testCase struct {
+		url     string
+		blocked bool
+	}
+
+	tests := []testCase{
+		{url: "https://evil.example/path", blocked: true},
+		{url: "https://EVIL.example/", blocked: true},
+		{url: "https://sub.evil.example/", blocked: false},
+		{url: "https://a.b.phishing.test/", blocked: true},
+		{url: "https://phishing.test/", blocked: false},
+		{url: "https://login-secure.bank.test/", blocked: true},
+		{url: "https://bank.test/", blocked: false},
+		{url: "https://practicum.yandex.ru/", blocked: false},
+		{url: "https://xn--e1afmkfd.xn--p1ai/", blocked: true},
+		{url: "https://login.xn--c1ajau6aza.test/", blocked: true},
+		{url: "https://xn--c1ajau6aza.test/", blocked: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			_, blocked := b.Match(test.url)
+			assert.Equal(t, test.blocked, blocked)
+		})
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	start := time.Now().Add(-time.Hour)
+	writeRules(t, path, "evil.example\n", start)
+
+	b, err := New([]string{path})
+	require.NoError(t, err)
+
+	reloaded, err := b.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "неизменённый файл не должен перечитываться")
+
+	writeRules(t, path, "other.example\n", start.Add(time.Minute))
+	reloaded, err = b.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	_, blocked := b.Match("https://evil.example/")
+	assert.False(t, blocked)
+	_, blocked = b.Match("https://other.example/")
+	assert.True(t, blocked)
+
+	writeRules(t, path, "re:[unclosed\n", start.Add(2*time.Minute))
+	_, err = b.Reload()
+	assert.Error(t, err)
+	_, blocked = b.Match("https://other.example/")
+	assert.True(t, blocked, "ошибка разбора не должна сбрасывать старые правила")
+}
+
+func TestBlocklistWatchDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, path, "evil.example\n", time.Now())
+
+	b, err := New([]string{path})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		b.Watch(context.Background(), 0, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch с нулевым интервалом должен сразу вернуться")
+	}
+}
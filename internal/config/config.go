@@ -2,7 +2,11 @@ package config
 
 import (
 	"flag"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -10,6 +14,40 @@ type Config struct {
 	BaseURL         string
 	FileStoragePath string
 	DatabaseDSN     string
+	MetricsAddress  string
+	TrustedSubnet   string
+
+	TraceExporter    string
+	TraceEndpoint    string
+	TraceSampleRatio float64
+
+	TrustedProxies    string
+	CreateRateLimit   float64
+	CreateBurst       int
+	RedirectRateLimit float64
+	RedirectBurst     int
+	RateLimitEntries  int
+
+	CompressMinSize       int
+	MaxBodySize           int64
+	MaxCompressedBodySize int64
+	MaxCompressionRatio   float64
+
+	AllowedSchemes      string
+	StripTrackingParams bool
+
+	BlocklistFiles          string
+	BlocklistReloadInterval time.Duration
+
+	SecretKey   string
+	UnlockTTL   time.Duration
+	UnlockRate  float64
+	UnlockBurst int
+	AdminUsers  string
+
+	TemplateDir  string
+	RedirectType string
+	GeoIPFile    string
 }
 
 func InitConfig() *Config {
@@ -19,6 +57,33 @@ func InitConfig() *Config {
 	flag.StringVar(&config.BaseURL, "b", "http://localhost:8080", "base address for the resulting shortened URL")
 	flag.StringVar(&config.FileStoragePath, "f", "", "file where the data is saved in JSON format")
 	flag.StringVar(&config.DatabaseDSN, "d", "", "DB connection address")
+	flag.StringVar(&config.MetricsAddress, "m", "", "separate address for the metrics endpoint")
+	flag.StringVar(&config.TrustedSubnet, "t", "", "trusted subnet in CIDR notation")
+	flag.StringVar(&config.TraceExporter, "trace-exporter", "none", "trace exporter: none, stdout or otlp")
+	flag.StringVar(&config.TraceEndpoint, "trace-endpoint", "", "OTLP HTTP endpoint URL for traces")
+	flag.Float64Var(&config.TraceSampleRatio, "trace-sample-ratio", 1, "fraction of traces to sample")
+	flag.StringVar(&config.TrustedProxies, "trusted-proxies", "", "comma-separated CIDRs of proxies allowed to set X-Forwarded-For")
+	flag.Float64Var(&config.CreateRateLimit, "create-rate", 10, "link creation requests per second per client, 0 disables the limit")
+	flag.IntVar(&config.CreateBurst, "create-burst", 100, "link creation burst per client")
+	flag.Float64Var(&config.RedirectRateLimit, "redirect-rate", 100, "redirect requests per second per client, 0 disables the limit")
+	flag.IntVar(&config.RedirectBurst, "redirect-burst", 200, "redirect burst per client")
+	flag.IntVar(&config.RateLimitEntries, "rate-limit-entries", 100000, "maximum number of clients tracked by each rate limiter")
+	flag.IntVar(&config.CompressMinSize, "compress-min-size", 256, "minimum response size in bytes to compress")
+	flag.Int64Var(&config.MaxBodySize, "max-body-size", 1<<20, "maximum request body size in bytes after decompression")
+	flag.Int64Var(&config.MaxCompressedBodySize, "max-compressed-body-size", 1<<20, "maximum compressed request body size in bytes")
+	flag.Float64Var(&config.MaxCompressionRatio, "max-compression-ratio", 100, "maximum decompressed to compressed size ratio of a request body")
+	flag.StringVar(&config.AllowedSchemes, "allowed-schemes", "http,https", "comma-separated URL schemes allowed for shortening")
+	flag.BoolVar(&config.StripTrackingParams, "strip-tracking", false, "remove utm_* and click ID parameters from shortened URLs")
+	flag.StringVar(&config.BlocklistFiles, "blocklist", "", "comma-separated files with blocked domains, *.wildcards and re:patterns")
+	flag.DurationVar(&config.BlocklistReloadInterval, "blocklist-reload", 30*time.Second, "how often to check blocklist files for changes, 0 disables reloading")
+	flag.StringVar(&config.SecretKey, "k", "", "secret key for signing cookies, random on every start if empty")
+	flag.DurationVar(&config.UnlockTTL, "unlock-ttl", 15*time.Minute, "how long a password-protected link stays unlocked")
+	flag.Float64Var(&config.UnlockRate, "unlock-rate", 0.1, "password attempts per second per client and link")
+	flag.IntVar(&config.UnlockBurst, "unlock-burst", 5, "password attempts burst per client and link")
+	flag.StringVar(&config.AdminUsers, "admin-users", "", "comma-separated user IDs whose sessions may issue admin API keys")
+	flag.StringVar(&config.RedirectType, "redirect-type", "307", "default redirect for links without their own: 301, 302, 307, 308, meta or js")
+	flag.StringVar(&config.GeoIPFile, "geoip", "", "CSV file with IP ranges and country codes for routing rules")
+	flag.StringVar(&config.TemplateDir, "templates", "", "directory with *.html files overriding the built-in page templates")
 	flag.Parse()
 
 	if envAddr := os.Getenv("SERVER_ADDRESS"); envAddr != "" {
@@ -33,6 +98,144 @@ func InitConfig() *Config {
 		config.DatabaseDSN = envDatabaseDSN
 	}
 
+	if envMetricsAddr := os.Getenv("METRICS_ADDRESS"); envMetricsAddr != "" {
+		config.MetricsAddress = envMetricsAddr
+	}
+
+	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
+		config.TrustedSubnet = envTrustedSubnet
+	}
+
+	if envTraceExporter := os.Getenv("TRACE_EXPORTER"); envTraceExporter != "" {
+		config.TraceExporter = envTraceExporter
+	}
+
+	if envTraceEndpoint := os.Getenv("TRACE_ENDPOINT"); envTraceEndpoint != "" {
+		config.TraceEndpoint = envTraceEndpoint
+	}
+
+	if envSampleRatio := os.Getenv("TRACE_SAMPLE_RATIO"); envSampleRatio != "" {
+		if ratio, err := strconv.ParseFloat(envSampleRatio, 64); err == nil {
+			config.TraceSampleRatio = ratio
+		}
+	}
+
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		config.TrustedProxies = envTrustedProxies
+	}
+
+	if envCreateRate := os.Getenv("CREATE_RATE_LIMIT"); envCreateRate != "" {
+		if rate, err := strconv.ParseFloat(envCreateRate, 64); err == nil {
+			config.CreateRateLimit = rate
+		}
+	}
+
+	if envCreateBurst := os.Getenv("CREATE_BURST"); envCreateBurst != "" {
+		if burst, err := strconv.Atoi(envCreateBurst); err == nil {
+			config.CreateBurst = burst
+		}
+	}
+
+	if envRedirectRate := os.Getenv("REDIRECT_RATE_LIMIT"); envRedirectRate != "" {
+		if rate, err := strconv.ParseFloat(envRedirectRate, 64); err == nil {
+			config.RedirectRateLimit = rate
+		}
+	}
+
+	if envRedirectBurst := os.Getenv("REDIRECT_BURST"); envRedirectBurst != "" {
+		if burst, err := strconv.Atoi(envRedirectBurst); err == nil {
+			config.RedirectBurst = burst
+		}
+	}
+
+	if envEntries := os.Getenv("RATE_LIMIT_ENTRIES"); envEntries != "" {
+		if entries, err := strconv.Atoi(envEntries); err == nil {
+			config.RateLimitEntries = entries
+		}
+	}
+
+	if envMinSize := os.Getenv("COMPRESS_MIN_SIZE"); envMinSize != "" {
+		if size, err := strconv.Atoi(envMinSize); err == nil {
+			config.CompressMinSize = size
+		}
+	}
+
+	if envMaxBody := os.Getenv("MAX_BODY_SIZE"); envMaxBody != "" {
+		if size, err := strconv.ParseInt(envMaxBody, 10, 64); err == nil {
+			config.MaxBodySize = size
+		}
+	}
+
+	if envMaxCompressed := os.Getenv("MAX_COMPRESSED_BODY_SIZE"); envMaxCompressed != "" {
+		if size, err := strconv.ParseInt(envMaxCompressed, 10, 64); err == nil {
+			config.MaxCompressedBodySize = size
+		}
+	}
+
+	if envRatio := os.Getenv("MAX_COMPRESSION_RATIO"); envRatio != "" {
+		if ratio, err := strconv.ParseFloat(envRatio, 64); err == nil {
+			config.MaxCompressionRatio = ratio
+		}
+	}
+
+	if envSchemes := os.Getenv("ALLOWED_SCHEMES"); envSchemes != "" {
+		config.AllowedSchemes = envSchemes
+	}
+
+	if envStrip := os.Getenv("STRIP_TRACKING_PARAMS"); envStrip != "" {
+		if strip, err := strconv.ParseBool(envStrip); err == nil {
+			config.StripTrackingParams = strip
+		}
+	}
+
+	if envBlocklist := os.Getenv("BLOCKLIST_FILES"); envBlocklist != "" {
+		config.BlocklistFiles = envBlocklist
+	}
+
+	if envReload := os.Getenv("BLOCKLIST_RELOAD_INTERVAL"); envReload != "" {
+		if interval, err := time.ParseDuration(envReload); err == nil {
+			config.BlocklistReloadInterval = interval
+		}
+	}
+
+	if envSecret := os.Getenv("SECRET_KEY"); envSecret != "" {
+		config.SecretKey = envSecret
+	}
+
+	if envAdmins := os.Getenv("ADMIN_USERS"); envAdmins != "" {
+		config.AdminUsers = envAdmins
+	}
+
+	if envUnlockTTL := os.Getenv("UNLOCK_TTL"); envUnlockTTL != "" {
+		if ttl, err := time.ParseDuration(envUnlockTTL); err == nil {
+			config.UnlockTTL = ttl
+		}
+	}
+
+	if envUnlockRate := os.Getenv("UNLOCK_RATE"); envUnlockRate != "" {
+		if rate, err := strconv.ParseFloat(envUnlockRate, 64); err == nil {
+			config.UnlockRate = rate
+		}
+	}
+
+	if envUnlockBurst := os.Getenv("UNLOCK_BURST"); envUnlockBurst != "" {
+		if burst, err := strconv.Atoi(envUnlockBurst); err == nil {
+			config.UnlockBurst = burst
+		}
+	}
+
+	if envRedirect := os.Getenv("REDIRECT_TYPE"); envRedirect != "" {
+		config.RedirectType = envRedirect
+	}
+
+	if envGeoIP := os.Getenv("GEOIP_FILE"); envGeoIP != "" {
+		config.GeoIPFile = envGeoIP
+	}
+
+	if envTemplates := os.Getenv("TEMPLATE_DIR"); envTemplates != "" {
+		config.TemplateDir = envTemplates
+	}
+
 	flagPath, ok := os.LookupEnv("FILE_STORAGE_PATH")
 	if ok {
 		config.FileStoragePath = flagPath
@@ -40,3 +243,25 @@ func InitConfig() *Config {
 
 	return &config
 }
+
+const redacted = "xxxxx"
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted возвращает копию конфигурации, которую можно показывать наружу:
+// ключ подписи и пароль в строке подключения к DB замаскированы.
+func (c Config) Redacted() Config {
+	if c.SecretKey != "" {
+		c.SecretKey = redacted
+	}
+	c.DatabaseDSN = redactDSN(c.DatabaseDSN)
+	return c
+}
+
+// redactDSN маскирует пароль в DSN как в виде URL, так и в виде пар key=value.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
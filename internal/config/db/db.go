@@ -21,19 +21,82 @@ func Initialize(DatabaseDSN string) (*sql.DB, error) {
 	return db, nil
 }
 
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS urls (
+		short_id VARCHAR(10) PRIMARY KEY,
+		original_url TEXT NOT NULL
+	)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS user_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS interstitial BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS query_params JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS query_conflict TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_query BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS active_until TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`,
+	`CREATE INDEX IF NOT EXISTS urls_user_id_idx ON urls (user_id)`,
+	`CREATE INDEX IF NOT EXISTS urls_user_created_idx ON urls (user_id, created_at, short_id)`,
+	`CREATE INDEX IF NOT EXISTS urls_user_clicks_idx ON urls (user_id, clicks, short_id)`,
+	`CREATE TABLE IF NOT EXISTS url_variant_clicks (
+		short_id VARCHAR(10) NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+		variant_id TEXT NOT NULL,
+		clicks BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (short_id, variant_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS url_history (
+		short_id VARCHAR(10) NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+		version BIGINT NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL,
+		changed_by TEXT NOT NULL,
+		changes JSONB NOT NULL,
+		PRIMARY KEY (short_id, version)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		hash TEXT NOT NULL,
+		scopes JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		id BIGSERIAL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		UNIQUE (user_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS url_tags (
+		short_id VARCHAR(10) NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+		tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (short_id, tag_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS url_tags_tag_id_idx ON url_tags (tag_id)`,
+}
+
 func InitializeSchema(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS urls (
-			short_id VARCHAR(10) PRIMARY KEY,
-			original_url TEXT NOT NULL
-		);
-	`
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.ExecContext(ctx, query)
-	if err != nil {
-		return err
+	for _, query := range schema {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,147 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Файл базы — CSV в формате бесплатных выгрузок вроде DB-IP Lite:
+//
+//	1.0.0.0,1.0.0.255,AU       диапазон адресов
+//	2001:db8::/32,NL           CIDR
+//
+// Пустые строки и строки, начинающиеся с #, пропускаются. Столбцы после кода
+// страны игнорируются.
+type ipRange struct {
+	start   netip.Addr
+	end     netip.Addr
+	country string
+}
+
+type DB struct {
+	ranges []ipRange
+}
+
+func Open(path string) (*DB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+func Parse(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	db := &DB{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rng, err := parseRecord(record)
+		if err != nil {
+			// Заголовок выгрузки пропускаем, остальные ошибки — повод не стартовать.
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("geoip: line %d: %w", line, err)
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+func parseRecord(record []string) (ipRange, error) {
+	if len(record) >= 2 && strings.Contains(record[0], "/") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		prefix = prefix.Masked()
+		return newRange(prefix.Addr(), lastAddr(prefix), record[1])
+	}
+
+	if len(record) < 3 {
+		return ipRange{}, errors.New("expected start,end,country or cidr,country")
+	}
+	start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+	if err != nil {
+		return ipRange{}, err
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+	if err != nil {
+		return ipRange{}, err
+	}
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return ipRange{}, fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	return newRange(start, end, record[2])
+}
+
+func newRange(start, end netip.Addr, country string) (ipRange, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 {
+		return ipRange{}, fmt.Errorf("invalid country code %q", country)
+	}
+	return ipRange{start: start.Unmap(), end: end.Unmap(), country: country}, nil
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Country возвращает ISO-код страны для адреса или пустую строку, если адрес
+// не разобран или не найден в базе.
+func (db *DB) Country(ip string) string {
+	if db == nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	// Последний диапазон, начинающийся не позже addr.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if i < 0 {
+		return ""
+	}
+
+	rng := db.ranges[i]
+	if rng.start.Is4() != addr.Is4() || rng.end.Less(addr) {
+		return ""
+	}
+	return rng.country
+}
+
+func (db *DB) Len() int {
+	return len(db.ranges)
+}
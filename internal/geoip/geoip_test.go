@@ -0,0 +1,51 @@
+package geoip
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sample = `start_ip,end_ip,country
+# комментарий
+1.0.0.0,1.0.0.255,AU
+5.8.0.0,5.8.255.255,ru
+2001:db8::/32,NL
+10.0.0.0/8,ZZ
+`
+
+func TestCountry(t *testing.T) {
+	db, err := Parse(strings.NewReader(sample))
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.Len())
+
+	tests := map[string]string{
+		"1.0.0.1":           "AU",
+		"1.0.0.255":         "AU",
+		"1.0.1.0":           "",
+		"5.8.13.1":          "RU",
+		"::ffff:5.8.13.1":   "RU",
+		"10.20.30.40":       "ZZ",
+		"2001:db8:1::1":     "NL",
+		"2001:db9::1":       "",
+		"0.0.0.1":           "",
+		"not an ip address": "",
+	}
+	for ip, country := range tests {
+		assert.Equal(t, country, db.Country(ip), ip)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	require.NoError(t, os.WriteFile(path, []byte("1.0.0.0,1.0.0.255,AU\n1.0.1.0,broken,AU\n"), 0o644))
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, "line 2")
+
+	var db *DB
+	assert.Empty(t, db.Country("1.0.0.1"), "nil-база ничего не находит")
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyResponse описывает ключ; сам ключ (Key) отдаётся только при создании.
+type APIKeyResponse struct {
+	ID        string     `json:"id"`
+	Key       string     `json:"key,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func apiKeyResponse(key model.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+// canManageKeys сообщает, можно ли управлять ключами из этого запроса: с
+// cookie-сессии или с ключом, у которого есть право admin. Иначе утёкший
+// ключ позволил бы выпустить себе замену.
+func canManageKeys(r *http.Request) bool {
+	return auth.APIKeyIDFromContext(r.Context()) == "" || auth.HasScope(r.Context(), auth.ScopeAdmin)
+}
+
+func (h *Handler) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		writeJSONError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Invalid content type", nil)
+		return
+	}
+	if !canManageKeys(r) {
+		writeJSONError(w, r, http.StatusForbidden, CodeForbidden, "API keys can only be managed by a session or an admin key", nil)
+		return
+	}
+
+	var req APIKeyRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	decoder.DisallowUnknownFields()
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large", nil)
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Failed to decode request body", err.Error())
+		return
+	}
+
+	// Выдать ключу можно только те права, что есть у самого запроса.
+	ctx := r.Context()
+	for _, scope := range req.Scopes {
+		if auth.ValidScope(scope) && !auth.HasScope(ctx, scope) {
+			writeJSONError(w, r, http.StatusForbidden, CodeForbidden, "Cannot grant a scope you do not have", scope)
+			return
+		}
+	}
+
+	key, token, err := h.service.CreateAPIKey(ctx, auth.UserIDFromContext(ctx), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	resp := apiKeyResponse(key)
+	resp.Key = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !canManageKeys(r) {
+		writeJSONError(w, r, http.StatusForbidden, CodeForbidden, "API keys can only be managed by a session or an admin key", nil)
+		return
+	}
+
+	ctx := r.Context()
+	keys, err := h.service.ListAPIKeys(ctx, auth.UserIDFromContext(ctx))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, apiKeyResponse(key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !canManageKeys(r) {
+		writeJSONError(w, r, http.StatusForbidden, CodeForbidden, "API keys can only be managed by a session or an admin key", nil)
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.service.RevokeAPIKey(ctx, auth.UserIDFromContext(ctx), chi.URLParam(r, "keyID")); err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,447 @@
+package handler
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/middleware"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"github.com/go-chi/chi/v5"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Панель управления ссылками — HTML-обёртка над теми же методами сервиса,
+// что и JSON API. Формы защищены middleware.CSRF.
+
+const (
+	dashboardPath     = "/dashboard"
+	dashboardPageSize = 20
+
+	// dashboardTimeLayout — формат поля <input type="datetime-local">.
+	// Время в панели указывается в UTC.
+	dashboardTimeLayout = "2006-01-02T15:04"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+type dashboardPage struct {
+	CSRFToken string
+	Query     string
+	Tag       string
+	Cursor    string
+	Links     []dashboardLink
+	FirstURL  string
+	NextURL   string
+	Notice    string
+	Error     string
+	Form      dashboardForm
+}
+
+type dashboardLink struct {
+	ID          string
+	ShortURL    string
+	OriginalURL string
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+	State       string
+	Clicks      int64
+	Tags        []string
+	// Bar — длина столбца на графике переходов, 0–100.
+	Bar int
+}
+
+type dashboardForm struct {
+	URL       string
+	Alias     string
+	ExpiresAt string
+	// Tags — метки через запятую.
+	Tags string
+}
+
+type dashboardLinkPage struct {
+	CSRFToken string
+	Link      dashboardLink
+	Version   int64
+	MaxClicks int64
+	Chart     []chartBar
+	Form      dashboardForm
+	Notice    string
+	Error     string
+}
+
+type chartBar struct {
+	Label  string
+	Clicks int64
+	Bar    int
+}
+
+// DashboardStatic отдаёт встроенные стили панели.
+func DashboardStatic() http.Handler {
+	static, _ := fs.Sub(staticFS, "static")
+	return http.StripPrefix(dashboardPath+"/static/", http.FileServerFS(static))
+}
+
+func (h *Handler) dashboardLink(link model.URLModel) dashboardLink {
+	return dashboardLink{
+		ID:          link.ShortURL,
+		ShortURL:    fmt.Sprintf("%s/%s", h.baseURL, link.ShortURL),
+		OriginalURL: link.OriginalURL,
+		CreatedAt:   link.CreatedAt,
+		ExpiresAt:   link.ExpiresAt,
+		State:       link.State(time.Now()),
+		Clicks:      link.Clicks,
+		Tags:        link.Tags,
+	}
+}
+
+// splitTags разбирает метки, введённые через запятую.
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// bar переводит число переходов в длину столбца относительно максимума.
+func bar(clicks, maxClicks int64) int {
+	if maxClicks <= 0 {
+		return 0
+	}
+	return int(clicks * 100 / maxClicks)
+}
+
+// dashboardError подбирает статус и сообщение для ошибки сервиса. Текст
+// ошибки не выводится: в нём может оказаться внутренняя цепочка причин.
+func dashboardError(r *http.Request, err error) (int, string) {
+	status, _, message := mapError(r, err)
+	return status, message
+}
+
+// parseDashboardTime разбирает значение datetime-local; пустое поле — nil.
+func parseDashboardTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(dashboardTimeLayout, value, time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: expiry must look like 2006-01-02T15:04", service.ErrorInvalidOptions)
+	}
+	return &t, nil
+}
+
+func formatDashboardTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(dashboardTimeLayout)
+}
+
+// parseDashboardForm разбирает тело формы. CSRF мог уже прочитать его,
+// тогда ParseForm вернёт сохранённый результат.
+func (h *Handler) parseDashboardForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
+	page := dashboardPage{
+		Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+		Tag:    strings.TrimSpace(r.URL.Query().Get("tag")),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	h.renderDashboard(w, r, http.StatusOK, page)
+}
+
+// renderDashboard дополняет page страницей ссылок пользователя с учётом
+// метки, поиска и курсора и выводит его. Отбор и постраничная выдача — те
+// же, что у GET /api/user/urls.
+func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, status int, page dashboardPage) {
+	ctx := r.Context()
+	userID := auth.UserIDFromContext(ctx)
+	list, err := h.service.ListLinks(ctx, userID, service.ListOptions{
+		Tag:    page.Tag,
+		Search: page.Query,
+		Cursor: page.Cursor,
+		Limit:  dashboardPageSize,
+	})
+	if err != nil {
+		status, message := dashboardError(r, err)
+		http.Error(w, message, status)
+		return
+	}
+
+	// Адрес созданной ссылки показывается, только если она своя.
+	params := r.URL.Query()
+	if created := params.Get("created"); created != "" {
+		if link, err := h.service.GetLink(ctx, created); err == nil && link.UserID == userID {
+			page.Notice = fmt.Sprintf("Ссылка создана: %s/%s", h.baseURL, link.ShortURL)
+		}
+	}
+	if params.Get("deleted") != "" {
+		page.Notice = "Ссылка удалена."
+	}
+
+	page.CSRFToken = middleware.CSRFTokenFromContext(ctx)
+
+	var maxClicks int64
+	for _, link := range list.Links {
+		maxClicks = max(maxClicks, link.Clicks)
+	}
+	for _, link := range list.Links {
+		item := h.dashboardLink(link)
+		item.Bar = bar(link.Clicks, maxClicks)
+		page.Links = append(page.Links, item)
+	}
+
+	pageURL := func(cursor string) string {
+		values := url.Values{}
+		if page.Query != "" {
+			values.Set("q", page.Query)
+		}
+		if page.Tag != "" {
+			values.Set("tag", page.Tag)
+		}
+		if cursor != "" {
+			values.Set("cursor", cursor)
+		}
+		if len(values) == 0 {
+			return dashboardPath
+		}
+		return dashboardPath + "?" + values.Encode()
+	}
+	if page.Cursor != "" {
+		page.FirstURL = pageURL("")
+	}
+	if list.NextCursor != "" {
+		page.NextURL = pageURL(list.NextCursor)
+	}
+
+	h.renderHTML(w, status, "dashboard.html", page)
+}
+
+func (h *Handler) DashboardCreate(w http.ResponseWriter, r *http.Request) {
+	if !h.parseDashboardForm(w, r) {
+		return
+	}
+
+	form := dashboardForm{
+		URL:       strings.TrimSpace(r.PostFormValue("url")),
+		Alias:     strings.TrimSpace(r.PostFormValue("alias")),
+		ExpiresAt: r.PostFormValue("expires_at"),
+		Tags:      r.PostFormValue("tags"),
+	}
+	fail := func(status int, message string) {
+		h.renderDashboard(w, r, status, dashboardPage{Form: form, Error: message})
+	}
+	if form.URL == "" {
+		fail(http.StatusBadRequest, "Укажите адрес назначения.")
+		return
+	}
+
+	expiresAt, err := parseDashboardTime(form.ExpiresAt)
+	if err != nil {
+		fail(dashboardError(r, err))
+		return
+	}
+
+	ctx := r.Context()
+	id, err := h.service.CreateShortURL(ctx, form.URL, service.CreateOptions{
+		UserID:    auth.UserIDFromContext(ctx),
+		Alias:     form.Alias,
+		ExpiresAt: expiresAt,
+		Tags:      splitTags(form.Tags),
+	})
+	if errors.Is(err, repository.ErrorAlreadyExists) && form.Alias != "" {
+		fail(http.StatusConflict, "Псевдоним уже занят, выберите другой.")
+		return
+	}
+	if err != nil {
+		fail(dashboardError(r, err))
+		return
+	}
+
+	http.Redirect(w, r, dashboardPath+"?created="+url.QueryEscape(id), http.StatusSeeOther)
+}
+
+// ownedDashboardLink возвращает ссылку текущего пользователя. Чужие ссылки
+// выглядят как несуществующие.
+func (h *Handler) ownedDashboardLink(w http.ResponseWriter, r *http.Request) (model.URLModel, bool) {
+	ctx := r.Context()
+	link, err := h.service.GetLink(ctx, chi.URLParam(r, "id"))
+	if err == nil && link.UserID != auth.UserIDFromContext(ctx) {
+		err = repository.ErrorNotFound
+	}
+	if err != nil {
+		status, message := dashboardError(r, err)
+		http.Error(w, message, status)
+		return model.URLModel{}, false
+	}
+	return link, true
+}
+
+func (h *Handler) DashboardLink(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedDashboardLink(w, r)
+	if !ok {
+		return
+	}
+
+	var notice string
+	switch query := r.URL.Query(); {
+	case query.Get("saved") != "":
+		notice = "Изменения сохранены."
+	case query.Get("tagged") != "":
+		notice = "Метки обновлены."
+	}
+	h.renderLinkPage(w, r, http.StatusOK, link, nil, notice, "")
+}
+
+// renderLinkPage выводит карточку ссылки. form — введённые значения, которые
+// нужно показать вместо сохранённых после ошибки.
+func (h *Handler) renderLinkPage(w http.ResponseWriter, r *http.Request, status int, link model.URLModel, form *dashboardForm, notice, message string) {
+	page := dashboardLinkPage{
+		CSRFToken: middleware.CSRFTokenFromContext(r.Context()),
+		Link:      h.dashboardLink(link),
+		Version:   link.Version,
+		MaxClicks: link.MaxClicks,
+		Form: dashboardForm{
+			URL:       link.OriginalURL,
+			ExpiresAt: formatDashboardTime(link.ExpiresAt),
+		},
+		Notice: notice,
+		Error:  message,
+	}
+	if form != nil {
+		page.Form = *form
+	}
+
+	// График: все переходы, лимит и переходы по вариантам в одном масштабе.
+	scale := max(link.Clicks, link.MaxClicks)
+	page.Chart = append(page.Chart, chartBar{Label: "Всего", Clicks: link.Clicks, Bar: bar(link.Clicks, scale)})
+	if link.MaxClicks > 0 {
+		page.Chart = append(page.Chart, chartBar{Label: "Лимит", Clicks: link.MaxClicks, Bar: bar(link.MaxClicks, scale)})
+	}
+	for _, v := range link.Variants {
+		page.Chart = append(page.Chart, chartBar{Label: "Вариант " + v.ID, Clicks: v.Clicks, Bar: bar(v.Clicks, scale)})
+	}
+
+	h.renderHTML(w, status, "dashboard_link.html", page)
+}
+
+func (h *Handler) DashboardUpdate(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedDashboardLink(w, r)
+	if !ok {
+		return
+	}
+	if !h.parseDashboardForm(w, r) {
+		return
+	}
+
+	form := dashboardForm{
+		URL:       strings.TrimSpace(r.PostFormValue("url")),
+		ExpiresAt: r.PostFormValue("expires_at"),
+	}
+	version, err := strconv.ParseInt(r.PostFormValue("version"), 10, 64)
+	if err != nil {
+		http.Error(w, "Version is required", http.StatusBadRequest)
+		return
+	}
+
+	patch := service.LinkPatch{OriginalURL: &form.URL}
+	if patch.ExpiresAt, err = parseDashboardTime(form.ExpiresAt); err != nil {
+		status, message := dashboardError(r, err)
+		h.renderLinkPage(w, r, status, link, &form, "", message)
+		return
+	}
+	patch.ClearExpiry = patch.ExpiresAt == nil
+	// Неизменённый срок не пишется в историю из-за отброшенных секунд.
+	if form.ExpiresAt == formatDashboardTime(link.ExpiresAt) {
+		patch.ExpiresAt, patch.ClearExpiry = nil, false
+	}
+
+	ctx := r.Context()
+	if _, err := h.service.UpdateLink(ctx, link.ShortURL, auth.UserIDFromContext(ctx), version, patch); err != nil {
+		status, message := dashboardError(r, err)
+		if status == http.StatusPreconditionFailed {
+			// Показываем свежую версию, чтобы правку можно было повторить.
+			if fresh, err := h.service.GetLink(ctx, link.ShortURL); err == nil {
+				link = fresh
+			}
+			h.renderLinkPage(w, r, http.StatusConflict, link, nil, "", "Ссылку изменили в другом окне; проверьте данные и сохраните ещё раз.")
+			return
+		}
+		h.renderLinkPage(w, r, status, link, &form, "", message)
+		return
+	}
+
+	http.Redirect(w, r, dashboardPath+"/links/"+url.PathEscape(link.ShortURL)+"?saved=1", http.StatusSeeOther)
+}
+
+func (h *Handler) DashboardDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	if err := h.service.DeleteLink(ctx, id, auth.UserIDFromContext(ctx)); err != nil {
+		status, message := dashboardError(r, err)
+		http.Error(w, message, status)
+		return
+	}
+
+	http.Redirect(w, r, dashboardPath+"?deleted="+url.QueryEscape(id), http.StatusSeeOther)
+}
+
+func (h *Handler) DashboardAddTags(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedDashboardLink(w, r)
+	if !ok {
+		return
+	}
+	if !h.parseDashboardForm(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := h.service.AddTags(ctx, link.ShortURL, auth.UserIDFromContext(ctx), splitTags(r.PostFormValue("tags"))); err != nil {
+		status, message := dashboardError(r, err)
+		h.renderLinkPage(w, r, status, link, nil, "", message)
+		return
+	}
+
+	http.Redirect(w, r, dashboardPath+"/links/"+url.PathEscape(link.ShortURL)+"?tagged=1", http.StatusSeeOther)
+}
+
+func (h *Handler) DashboardRemoveTag(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedDashboardLink(w, r)
+	if !ok {
+		return
+	}
+	if !h.parseDashboardForm(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := h.service.RemoveTags(ctx, link.ShortURL, auth.UserIDFromContext(ctx), []string{r.PostFormValue("tag")}); err != nil {
+		status, message := dashboardError(r, err)
+		h.renderLinkPage(w, r, status, link, nil, "", message)
+		return
+	}
+
+	http.Redirect(w, r, dashboardPath+"/links/"+url.PathEscape(link.ShortURL)+"?tagged=1", http.StatusSeeOther)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/middleware"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidURL           = "invalid_url"
+	CodeBlockedURL           = "blocked_url"
+	CodeInvalidOptions       = "invalid_options"
+	CodeInvalidPassword      = "invalid_password"
+	CodeWrongPassword        = "wrong_password"
+	CodeForbidden            = "forbidden"
+	CodeInvalidAPIKey        = "invalid_api_key"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeNotFound             = "not_found"
+	CodeAlreadyExists        = "already_exists"
+	CodeGone                 = "gone"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeInternal             = "internal_error"
+)
+
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ErrorDetails указывает поле запроса, не прошедшее проверку, и причину.
+type ErrorDetails struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type errorMapping struct {
+	target  error
+	status  int
+	code    string
+	message string
+}
+
+var errorMappings = []errorMapping{
+	{repository.ErrorNotFound, http.StatusNotFound, CodeNotFound, "URL not found"},
+	{repository.ErrorAlreadyExists, http.StatusConflict, CodeAlreadyExists, "URL already exists"},
+	{repository.ErrorGone, http.StatusGone, CodeGone, "URL is no longer available"},
+	{service.ErrorInvalidURL, http.StatusUnprocessableEntity, CodeInvalidURL, "Invalid URL"},
+	{service.ErrorBlockedURL, http.StatusUnprocessableEntity, CodeBlockedURL, "URL is blocked"},
+	{service.ErrorInvalidOptions, http.StatusUnprocessableEntity, CodeInvalidOptions, "Invalid link options"},
+	{service.ErrorInvalidPassword, http.StatusUnprocessableEntity, CodeInvalidPassword, "Invalid password"},
+	{service.ErrorWrongPassword, http.StatusUnauthorized, CodeWrongPassword, "Wrong password"},
+	{service.ErrorForbidden, http.StatusForbidden, CodeForbidden, "URL belongs to another user"},
+	{repository.ErrorConflict, http.StatusPreconditionFailed, CodePreconditionFailed, "URL was modified, fetch it again"},
+	{service.ErrorInvalidAPIKey, http.StatusUnauthorized, CodeInvalidAPIKey, "Invalid API key"},
+	{service.ErrorAPIKeyNotFound, http.StatusNotFound, CodeNotFound, "API key not found"},
+	{service.ErrorTagNotFound, http.StatusNotFound, CodeNotFound, "Tag not found"},
+}
+
+func mapError(r *http.Request, err error) (int, string, string) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			return m.status, m.code, m.message
+		}
+	}
+
+	logger.FromContext(r.Context()).Error("Ошибка обработки запроса", zap.Error(err))
+	return http.StatusInternalServerError, CodeInternal, "Server error"
+}
+
+// validationDetails возвращает пояснение из service.ValidationError в
+// цепочке err. Остальной текст ошибки наружу не отдаётся: в нём может
+// оказаться внутренняя цепочка причин.
+func validationDetails(err error) *ErrorDetails {
+	var validation *service.ValidationError
+	if !errors.As(err, &validation) {
+		return nil
+	}
+	return &ErrorDetails{Field: validation.Field, Message: validation.Message}
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func requestID(r *http.Request) string {
+	if id := middleware.RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get(middleware.RequestIDHeader)
+}
+
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	resp := ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func writeServiceJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := mapError(r, err)
+
+	var details any
+	if validation := validationDetails(err); validation != nil {
+		details = validation
+	}
+	writeJSONError(w, r, status, code, message, details)
+}
+
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	status, _, message := mapError(r, err)
+	if validation := validationDetails(err); validation != nil {
+		if validation.Field != "" {
+			message += ": " + validation.Field
+		}
+		message += ": " + validation.Message
+	}
+	http.Error(w, message, status)
+}
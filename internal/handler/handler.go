@@ -5,8 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/metrics"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
 	"github.com/go-chi/chi/v5"
+	"html/template"
 	"io"
 	"net/http"
 	"strings"
@@ -14,29 +19,139 @@ import (
 )
 
 type RequestJSON struct {
-	URL string `json:"url"`
+	URL          string          `json:"url"`
+	Alias        string          `json:"alias,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	Password     string          `json:"password,omitempty"`
+	MaxClicks    int64           `json:"max_clicks,omitempty"`
+	Interstitial bool            `json:"interstitial,omitempty"`
+	RedirectType string          `json:"redirect_type,omitempty"`
+	Rules        []model.Rule    `json:"rules,omitempty"`
+	Variants     []model.Variant `json:"variants,omitempty"`
+
+	QueryParams   map[string]string `json:"query_params,omitempty"`
+	QueryConflict string            `json:"query_conflict,omitempty"`
+	ForwardQuery  bool              `json:"forward_query,omitempty"`
+
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
+
+	QR bool `json:"qr,omitempty"`
 }
 
 type ResponseJSON struct {
 	Result string `json:"result"`
+	QRCode string `json:"qr_code,omitempty"`
 }
 
+const (
+	defaultMaxBodySize = 1 << 20
+	defaultUnlockTTL   = 15 * time.Minute
+)
+
 type Handler struct {
-	service service.URLShortener
-	baseURL string
-	db      *sql.DB
+	service     service.URLShortener
+	baseURL     string
+	db          *sql.DB
+	maxBodySize int64
+	signer      *auth.Signer
+	unlockTTL   time.Duration
+	templates   *template.Template
+
+	defaultRedirect string
+	country         CountryFunc
+
+	config any
+}
+
+// CountryFunc определяет страну посетителя (ISO 3166-1 alpha-2) для правил
+// маршрутизации; пустая строка — страна неизвестна.
+type CountryFunc func(r *http.Request) string
+
+type Option func(*Handler)
+
+func WithMaxBodySize(size int64) Option {
+	return func(h *Handler) {
+		if size > 0 {
+			h.maxBodySize = size
+		}
+	}
+}
+
+func WithSigner(signer *auth.Signer) Option {
+	return func(h *Handler) {
+		h.signer = signer
+	}
 }
 
-func NewHandler(s service.URLShortener, baseURL string, db *sql.DB) *Handler {
-	return &Handler{
-		service: s,
-		baseURL: baseURL,
-		db:      db,
+func WithUnlockTTL(ttl time.Duration) Option {
+	return func(h *Handler) {
+		if ttl > 0 {
+			h.unlockTTL = ttl
+		}
+	}
+}
+
+// WithDefaultRedirect задаёт способ перехода для ссылок, у которых он не указан.
+func WithDefaultRedirect(redirectType string) Option {
+	return func(h *Handler) {
+		if model.ValidRedirectType(redirectType) {
+			h.defaultRedirect = redirectType
+		}
+	}
+}
+
+func WithCountryFunc(country CountryFunc) Option {
+	return func(h *Handler) {
+		h.country = country
+	}
+}
+
+// WithConfig задаёт конфигурацию, которую отдаёт GET /api/internal/config.
+// Секреты в ней должны быть уже замаскированы.
+func WithConfig(config any) Option {
+	return func(h *Handler) {
+		h.config = config
+	}
+}
+
+// WithTemplates заменяет встроенные шаблоны HTML-страниц, см. LoadTemplates.
+func WithTemplates(templates *template.Template) Option {
+	return func(h *Handler) {
+		if templates != nil {
+			h.templates = templates
+		}
+	}
+}
+
+func NewHandler(s service.URLShortener, baseURL string, db *sql.DB, opts ...Option) *Handler {
+	h := &Handler{
+		service:     s,
+		baseURL:     baseURL,
+		db:          db,
+		maxBodySize: defaultMaxBodySize,
+		signer:      auth.NewSigner(""),
+		unlockTTL:   defaultUnlockTTL,
+		templates:   defaultTemplates,
+
+		defaultRedirect: model.RedirectTemporary,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if isBodyTooLarge(err) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Request body could not be read", http.StatusBadRequest)
 		return
@@ -50,9 +165,11 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 	originalURL := string(body)
 
 	ctx := r.Context()
-	id, err := h.service.CreateShortURL(ctx, originalURL)
+	id, err := h.service.CreateShortURL(ctx, originalURL, service.CreateOptions{
+		UserID: auth.UserIDFromContext(ctx),
+	})
 	if err != nil {
-		http.Error(w, "Server error", http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
 
@@ -64,59 +181,133 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	// "/{id}+" показывает страницу предпросмотра вместо перехода.
+	id, preview := strings.CutSuffix(chi.URLParam(r, "id"), previewSuffix)
 	if id == "" {
 		http.Error(w, "ID cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	ctx := r.Context()
-	originalURL, err := h.service.GetOriginalURL(ctx, id)
+	link, err := h.service.GetLink(ctx, id)
 	if err != nil {
-		http.Error(w, "URL not found", http.StatusBadRequest)
+		writeServiceError(w, r, err)
+		return
+	}
+
+	// Пароль проверяется первым: страница отключённой ссылки и резервный
+	// адрес не должны раскрывать ничего без него.
+	if link.PasswordHash != "" && !h.unlocked(r, id) {
+		h.renderHTML(w, http.StatusOK, "password.html", passwordPage{ID: id})
+		return
+	}
+
+	if link.Disabled {
+		h.renderHTML(w, http.StatusForbidden, "warning.html", link)
+		return
+	}
+
+	if !link.Active(time.Now()) {
+		h.inactive(w, r, link)
+		return
+	}
+
+	// Предпросмотр и HEAD не засчитывают переход, но для исчерпанной или
+	// истёкшей ссылки отвечают так же, как GET.
+	if link.ClicksExhausted() || link.Expired(time.Now()) {
+		writeServiceError(w, r, repository.ErrorGone)
+		return
+	}
+
+	// HEAD отвечает так же, как GET, но переход не засчитывается.
+	click := !preview && r.Method != http.MethodHead
+	routed, variant := h.route(w, r, link, click)
+	if preview {
+		h.renderHTML(w, http.StatusOK, "preview.html", h.newPreviewPage(routed, "/"+id))
+		return
+	}
+
+	if click {
+		if _, err := h.service.RegisterClick(ctx, id, variant); err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+		metrics.RedirectsTotal.Inc()
+	}
+
+	link = routed
+	if link.Interstitial {
+		h.renderHTML(w, http.StatusOK, "preview.html", h.newPreviewPage(link, link.OriginalURL))
 		return
 	}
 
-	w.Header().Set("Location", originalURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	h.redirect(w, link)
 }
 
 func (h *Handler) PostShorten(w http.ResponseWriter, r *http.Request) {
 	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "invalid content type", http.StatusUnsupportedMediaType)
+		writeJSONError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Invalid content type", nil)
 		return
 	}
 
 	var req RequestJSON
-	decoder := json.NewDecoder(r.Body)
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
 	defer r.Body.Close()
 	if err := decoder.Decode(&req); err != nil {
-		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large", nil)
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Failed to decode request body", err.Error())
 		return
 	}
 
 	if req.URL == "" {
-		http.Error(w, "URL field is missing", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "URL field is missing", nil)
 		return
 	}
 
 	ctx := r.Context()
-	id, err := h.service.CreateShortURL(ctx, req.URL)
+	id, err := h.service.CreateShortURL(ctx, req.URL, service.CreateOptions{
+		UserID:       auth.UserIDFromContext(ctx),
+		Alias:        req.Alias,
+		ExpiresAt:    req.ExpiresAt,
+		Password:     req.Password,
+		MaxClicks:    req.MaxClicks,
+		Interstitial: req.Interstitial,
+		RedirectType: req.RedirectType,
+		Rules:        req.Rules,
+		Variants:     req.Variants,
+
+		QueryParams:   req.QueryParams,
+		QueryConflict: req.QueryConflict,
+		ForwardQuery:  req.ForwardQuery,
+
+		ActiveFrom:  req.ActiveFrom,
+		ActiveUntil: req.ActiveUntil,
+		FallbackURL: req.FallbackURL,
+
+		Tags: req.Tags,
+	})
 	if err != nil {
-		http.Error(w, "Server error", http.StatusInternalServerError)
+		writeServiceJSONError(w, r, err)
 		return
 	}
 
 	shortURL := fmt.Sprintf("%s/%s", h.baseURL, id)
 	resp := ResponseJSON{Result: shortURL}
+	if req.QR {
+		resp.QRCode, err = qrDataURI(shortURL)
+		if err != nil {
+			writeServiceJSONError(w, r, err)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
-	if err := json.NewEncoder(w).Encode(&resp); err != nil {
-		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
-		return
-	}
+	json.NewEncoder(w).Encode(&resp)
 }
 
 func (h *Handler) GetPing(w http.ResponseWriter, r *http.Request) {
@@ -1,29 +1,144 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/middleware"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 type MockService struct {
-	CreateShortURLFunc func(ctx context.Context, originalURL string) (string, error)
-	GetOriginalURLFunc func(ctx context.Context, id string) (string, error)
+	CreateShortURLFunc func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error)
+	GetLinkFunc        func(ctx context.Context, id string) (model.URLModel, error)
+	UnlockLinkFunc     func(ctx context.Context, id, password string) (model.URLModel, error)
+	RegisterClickFunc  func(ctx context.Context, id, variant string) (model.URLModel, error)
+	UpdateLinkFunc     func(ctx context.Context, id, userID string, version int64, patch service.LinkPatch) (model.URLModel, error)
+	LinkHistoryFunc    func(ctx context.Context, id, userID string) ([]model.HistoryEntry, error)
+	LinkStatsFunc      func(ctx context.Context, id, userID string) (model.URLModel, error)
+	ListLinksFunc      func(ctx context.Context, userID string, opts service.ListOptions) (service.LinkPage, error)
+	DeleteLinkFunc     func(ctx context.Context, id, userID string) error
+
+	AddTagsFunc    func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error)
+	RemoveTagsFunc func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error)
+	ListTagsFunc   func(ctx context.Context, userID string) ([]repository.TagStats, error)
+	TagStatsFunc   func(ctx context.Context, userID, tag string) (repository.TagStats, error)
+
+	CreateAPIKeyFunc func(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (model.APIKey, string, error)
+	ListAPIKeysFunc  func(ctx context.Context, userID string) ([]model.APIKey, error)
+	RevokeAPIKeyFunc func(ctx context.Context, userID, id string) error
+
+	TotalsFunc          func(ctx context.Context) (repository.Totals, error)
+	LookupLinkFunc      func(ctx context.Context, id string) (model.URLModel, error)
+	SetLinkDisabledFunc func(ctx context.Context, id string, disabled bool, reason string) (model.URLModel, error)
+	DeleteUserLinksFunc func(ctx context.Context, userID string) (int64, error)
+}
+
+func (m *MockService) AddTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+	return m.AddTagsFunc(ctx, id, userID, tags)
+}
+
+func (m *MockService) RemoveTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+	return m.RemoveTagsFunc(ctx, id, userID, tags)
+}
+
+func (m *MockService) ListTags(ctx context.Context, userID string) ([]repository.TagStats, error) {
+	return m.ListTagsFunc(ctx, userID)
+}
+
+func (m *MockService) TagStats(ctx context.Context, userID, tag string) (repository.TagStats, error) {
+	return m.TagStatsFunc(ctx, userID, tag)
+}
+
+func (m *MockService) Totals(ctx context.Context) (repository.Totals, error) {
+	return m.TotalsFunc(ctx)
+}
+
+func (m *MockService) LookupLink(ctx context.Context, id string) (model.URLModel, error) {
+	return m.LookupLinkFunc(ctx, id)
+}
+
+func (m *MockService) SetLinkDisabled(ctx context.Context, id string, disabled bool, reason string) (model.URLModel, error) {
+	return m.SetLinkDisabledFunc(ctx, id, disabled, reason)
+}
+
+func (m *MockService) DeleteUserLinks(ctx context.Context, userID string) (int64, error) {
+	return m.DeleteUserLinksFunc(ctx, userID)
+}
+
+func (m *MockService) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (model.APIKey, string, error) {
+	return m.CreateAPIKeyFunc(ctx, userID, name, scopes, expiresAt)
+}
+
+func (m *MockService) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return m.ListAPIKeysFunc(ctx, userID)
+}
+
+func (m *MockService) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	return m.RevokeAPIKeyFunc(ctx, userID, id)
+}
+
+func (m *MockService) AuthenticateAPIKey(ctx context.Context, token string) (model.APIKey, error) {
+	return model.APIKey{}, service.ErrorInvalidAPIKey
+}
+
+func (m *MockService) DeleteLink(ctx context.Context, id, userID string) error {
+	return m.DeleteLinkFunc(ctx, id, userID)
+}
+
+func (m *MockService) ListLinks(ctx context.Context, userID string, opts service.ListOptions) (service.LinkPage, error) {
+	return m.ListLinksFunc(ctx, userID, opts)
+}
+
+func (m *MockService) UpdateLink(ctx context.Context, id, userID string, version int64, patch service.LinkPatch) (model.URLModel, error) {
+	return m.UpdateLinkFunc(ctx, id, userID, version, patch)
+}
+
+func (m *MockService) LinkHistory(ctx context.Context, id, userID string) ([]model.HistoryEntry, error) {
+	return m.LinkHistoryFunc(ctx, id, userID)
+}
+
+func (m *MockService) LinkStats(ctx context.Context, id, userID string) (model.URLModel, error) {
+	return m.LinkStatsFunc(ctx, id, userID)
+}
+
+func (m *MockService) RegisterClick(ctx context.Context, id, variant string) (model.URLModel, error) {
+	if m.RegisterClickFunc == nil {
+		return m.GetLinkFunc(ctx, id)
+	}
+	return m.RegisterClickFunc(ctx, id, variant)
+}
+
+func (m *MockService) CreateShortURL(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
+	return m.CreateShortURLFunc(ctx, originalURL, opts)
 }
 
-func (m *MockService) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
-	return m.CreateShortURLFunc(ctx, originalURL)
+func (m *MockService) UnlockLink(ctx context.Context, id, password string) (model.URLModel, error) {
+	return m.UnlockLinkFunc(ctx, id, password)
 }
 
-func (m *MockService) GetOriginalURL(ctx context.Context, id string) (string, error) {
-	return m.GetOriginalURLFunc(ctx, id)
+func (m *MockService) GetLink(ctx context.Context, id string) (model.URLModel, error) {
+	return m.GetLinkFunc(ctx, id)
 }
 
 func TestPostHandler(t *testing.T) {
@@ -55,6 +170,27 @@ func TestPostHandler(t *testing.T) {
 			mockError:      errors.New("не удалось сохранить"),
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:           "Недопустимая схема URL",
+			requestBody:    "javascript:alert(1)",
+			mockError:      &service.ValidationError{Err: service.ErrorInvalidURL, Message: `scheme "javascript" is not allowed`},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   "Invalid URL: scheme \"javascript\" is not allowed\n",
+		},
+		{
+			name:           "Пояснение указывает поле",
+			requestBody:    "https://yandex.ru",
+			mockError:      &service.ValidationError{Err: service.ErrorInvalidURL, Field: "fallback_url", Message: "URL must be absolute"},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   "Invalid URL: fallback_url: URL must be absolute\n",
+		},
+		{
+			name:           "Текст ошибки без пояснения не раскрывается",
+			requestBody:    "https://yandex.ru",
+			mockError:      fmt.Errorf("pg: relation urls: %w", service.ErrorInvalidOptions),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   "Invalid link options\n",
+		},
 	}
 
 	for _, test := range tests {
@@ -63,7 +199,7 @@ func TestPostHandler(t *testing.T) {
 		recorder := httptest.NewRecorder()
 
 		mockService := &MockService{
-			CreateShortURLFunc: func(ctx context.Context, originalURL string) (string, error) {
+			CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
 				return test.mockID, test.mockError
 			},
 		}
@@ -112,8 +248,15 @@ func TestGetHandler(t *testing.T) {
 			requestURL:       "/notFoundID",
 			method:           http.MethodGet,
 			mockOriginalURL:  "",
-			mockError:        errors.New("URL not found"),
-			expectedStatus:   http.StatusBadRequest,
+			mockError:        repository.ErrorNotFound,
+			expectedStatus:   http.StatusNotFound,
+			expectedLocation: "",
+		},
+		{
+			name:             "Ссылка отключена блок-листом",
+			requestURL:       "/blockedID",
+			method:           http.MethodGet,
+			expectedStatus:   http.StatusForbidden,
 			expectedLocation: "",
 		},
 		{
@@ -138,11 +281,19 @@ func TestGetHandler(t *testing.T) {
 			recorder := httptest.NewRecorder()
 
 			mockService := &MockService{
-				GetOriginalURLFunc: func(ctx context.Context, id string) (string, error) {
-					if id == "shortID123" {
-						return test.mockOriginalURL, test.mockError
+				GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+					switch id {
+					case "shortID123":
+						return model.URLModel{ShortURL: id, OriginalURL: test.mockOriginalURL}, test.mockError
+					case "blockedID":
+						return model.URLModel{
+							ShortURL:       id,
+							OriginalURL:    "https://phishing.example/",
+							Disabled:       true,
+							DisabledReason: model.DisabledByBlocklist,
+						}, nil
 					}
-					return "", errors.New("URL not found")
+					return model.URLModel{}, repository.ErrorNotFound
 				},
 			}
 
@@ -227,7 +378,7 @@ func TestPostShortenHandler(t *testing.T) {
 			recorder := httptest.NewRecorder()
 
 			mockService := &MockService{
-				CreateShortURLFunc: func(ctx context.Context, originalURL string) (string, error) {
+				CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
 					return test.mockID, test.mockError
 				},
 			}
@@ -250,3 +401,1305 @@ func TestPostShortenHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestPostShortenErrorResponse(t *testing.T) {
+	type testCase struct {
+		name            string
+		mockError       error
+		expectedStatus  int
+		expectedCode    string
+		expectedDetails any
+	}
+	tests := []testCase{
+		{
+			name:           "Конфликт ID",
+			mockError:      fmt.Errorf("не удалось сохранить URL в сервисе: %w", repository.ErrorAlreadyExists),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   CodeAlreadyExists,
+		},
+		{
+			name:            "Невалидный URL",
+			mockError:       &service.ValidationError{Err: service.ErrorInvalidURL, Message: "URL cannot be empty"},
+			expectedStatus:  http.StatusUnprocessableEntity,
+			expectedCode:    CodeInvalidURL,
+			expectedDetails: map[string]any{"message": "URL cannot be empty"},
+		},
+		{
+			name: "Пояснение из обёрнутой ошибки",
+			mockError: fmt.Errorf("rule 2: %w", &service.ValidationError{
+				Err: service.ErrorInvalidURL, Field: "rules[1].destination", Message: "URL must be absolute",
+			}),
+			expectedStatus:  http.StatusUnprocessableEntity,
+			expectedCode:    CodeInvalidURL,
+			expectedDetails: map[string]any{"field": "rules[1].destination", "message": "URL must be absolute"},
+		},
+		{
+			name:           "Внутренняя цепочка не раскрывается",
+			mockError:      fmt.Errorf("pg: relation urls: %w", fmt.Errorf("%w: tag too long", service.ErrorInvalidOptions)),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   CodeInvalidOptions,
+		},
+		{
+			name:           "Ссылка недоступна",
+			mockError:      repository.ErrorGone,
+			expectedStatus: http.StatusGone,
+			expectedCode:   CodeGone,
+		},
+		{
+			name:           "Внутренняя ошибка",
+			mockError:      errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   CodeInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://yandex.ru"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "req-42")
+			recorder := httptest.NewRecorder()
+
+			mockService := &MockService{
+				CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
+					return "", test.mockError
+				},
+			}
+
+			handler := NewHandler(mockService, "http://localhost:8080", nil)
+			handler.PostShorten(recorder, req)
+
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, test.expectedStatus, res.StatusCode, "Код ответа не совпадает")
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+			var body ErrorResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, test.expectedCode, body.Code)
+			assert.NotEmpty(t, body.Message)
+			assert.Equal(t, test.expectedDetails, body.Details)
+			assert.Equal(t, "req-42", body.RequestID)
+		})
+	}
+}
+
+func TestBodySizeLimit(t *testing.T) {
+	mockService := &MockService{
+		CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
+			return "E9wVbL1G", nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithMaxBodySize(16))
+
+	t.Run("text/plain", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/"+strings.Repeat("a", 64)))
+		recorder := httptest.NewRecorder()
+
+		handler.Post(recorder, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com/`+strings.Repeat("a", 64)+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+
+		handler.PostShorten(recorder, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		var body ErrorResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+		assert.Equal(t, CodePayloadTooLarge, body.Code)
+	})
+}
+
+func TestPasswordProtectedLink(t *testing.T) {
+	link := model.URLModel{
+		ShortURL:     "secretID",
+		OriginalURL:  "https://docs.internal.example/",
+		PasswordHash: "hash",
+	}
+
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			if id == link.ShortURL {
+				return link, nil
+			}
+			return model.URLModel{}, repository.ErrorNotFound
+		},
+		UnlockLinkFunc: func(ctx context.Context, id, password string) (model.URLModel, error) {
+			if password != "s3cret" {
+				return model.URLModel{}, service.ErrorWrongPassword
+			}
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithSigner(auth.NewSigner("test")))
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+	router.Post("/{id}", handler.PostUnlock)
+
+	do := func(req *http.Request) *http.Response {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	res := do(httptest.NewRequest(http.MethodGet, "/secretID", nil))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "text/html")
+	assert.Empty(t, res.Header.Get("Location"))
+
+	form := url.Values{"password": {"wrong"}}
+	req := httptest.NewRequest(http.MethodPost, "/secretID", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = do(req)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Empty(t, res.Cookies())
+
+	form = url.Values{"password": {"s3cret"}}
+	req = httptest.NewRequest(http.MethodPost, "/secretID", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = do(req)
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, "/", cookies[0].Path, "cookie нужна и для предпросмотра")
+
+	req = httptest.NewRequest(http.MethodGet, "/secretID", nil)
+	req.AddCookie(cookies[0])
+	res = do(req)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, link.OriginalURL, res.Header.Get("Location"))
+
+	req = httptest.NewRequest(http.MethodGet, "/secretID+", nil)
+	req.AddCookie(cookies[0])
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), link.OriginalURL)
+
+	// Отключённая ссылка без пароля показывает форму, а не адрес назначения.
+	link.Disabled = true
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/secretID", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), link.OriginalURL)
+	link.Disabled = false
+
+	forged := *cookies[0]
+	forged.Value = "secretID|9999999999.forged"
+	req = httptest.NewRequest(http.MethodGet, "/secretID", nil)
+	req.AddCookie(&forged)
+	res = do(req)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "поддельная cookie не должна открывать ссылку")
+}
+
+func TestMaxClicksLink(t *testing.T) {
+	link := model.URLModel{ShortURL: "onceID", OriginalURL: "https://files.example/download", UserID: "owner", MaxClicks: 1}
+
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+		LinkStatsFunc: func(ctx context.Context, id, userID string) (model.URLModel, error) {
+			if userID != link.UserID {
+				return model.URLModel{}, service.ErrorForbidden
+			}
+			return link, nil
+		},
+		RegisterClickFunc: func(ctx context.Context, id, variant string) (model.URLModel, error) {
+			if link.ClicksExhausted() {
+				return model.URLModel{}, repository.ErrorGone
+			}
+			link.Clicks++
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+	router.Get("/api/urls/{id}/stats", handler.GetStats)
+
+	stats := func() StatsResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/onceID/stats", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req.WithContext(auth.WithUserID(req.Context(), "owner")))
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var resp StatsResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+		return resp
+	}
+
+	before := stats()
+	require.NotNil(t, before.RemainingClicks)
+	assert.Equal(t, int64(1), *before.RemainingClicks)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/onceID", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/onceID", nil))
+	assert.Equal(t, http.StatusGone, recorder.Code)
+
+	after := stats()
+	assert.Equal(t, int64(1), after.Clicks)
+	require.NotNil(t, after.RemainingClicks)
+	assert.Equal(t, int64(0), *after.RemainingClicks)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/urls/onceID/stats", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "статистика чужой ссылки закрыта")
+}
+
+func TestPatchURL(t *testing.T) {
+	link := model.URLModel{ShortURL: "editID", OriginalURL: "https://typo.example/", UserID: "owner", Version: 1}
+	var lastPatch service.LinkPatch
+
+	mockService := &MockService{
+		UpdateLinkFunc: func(ctx context.Context, id, userID string, version int64, patch service.LinkPatch) (model.URLModel, error) {
+			if userID != link.UserID {
+				return model.URLModel{}, service.ErrorForbidden
+			}
+			if version != service.AnyVersion && version != link.Version {
+				return model.URLModel{}, repository.ErrorConflict
+			}
+			lastPatch = patch
+			if patch.OriginalURL != nil {
+				link.OriginalURL = *patch.OriginalURL
+			}
+			link.Version++
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Patch("/api/urls/{id}", handler.PatchURL)
+
+	patch := func(userID, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/urls/editID", strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := patch("owner", "", `{"original_url":"https://fixed.example/"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+
+	recorder = patch("owner", `"v1"`, `{"original_url":"https://fixed.example/","expires_at":null}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `"v2"`, recorder.Header().Get("ETag"))
+	assert.True(t, lastPatch.ClearExpiry)
+
+	var resp LinkResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, "https://fixed.example/", resp.OriginalURL)
+	assert.Equal(t, int64(2), resp.Version)
+
+	recorder = patch("owner", `"v1"`, `{"original_url":"https://stale.example/"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	recorder = patch("owner", "", `{"original_url":"https://again.example/","version":2}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = patch("intruder", `"v3"`, `{"original_url":"https://evil.example/"}`)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = patch("owner", `"v3"`, `{"url":"https://fixed.example/"}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = patch("owner", "*", `{"original_url":"https://any.example/"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code, "If-Match: * совпадает с любой версией")
+	assert.Equal(t, `"v4"`, recorder.Header().Get("ETag"))
+}
+
+func TestGetQR(t *testing.T) {
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			if id != "qrID" {
+				return model.URLModel{}, repository.ErrorNotFound
+			}
+			return model.URLModel{ShortURL: id, OriginalURL: "https://print.example/"}, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/api/urls/{id}/qr", handler.GetQR)
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/api/urls/qrID/qr?size=128&ecc=h&fg=123456", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, qrCacheControl, recorder.Header().Get("Cache-Control"))
+	img, err := png.Decode(recorder.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+
+	tag := recorder.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+	assert.Equal(t, http.StatusNotModified, get("/api/urls/qrID/qr?size=128&ecc=h&fg=123456", tag).Code)
+	assert.Equal(t, http.StatusOK, get("/api/urls/qrID/qr?size=256", tag).Code, "другие параметры — другой ETag")
+	assert.Equal(t, http.StatusNotModified, get("/api/urls/qrID/qr?size=128&ecc=h&fg=123456", `"other", W/`+tag).Code)
+	assert.Equal(t, http.StatusOK, get("/api/urls/qrID/qr?size=128&ecc=h&fg=123456", tag+"-stale").Code,
+		"тег, лишь содержащий ETag, не совпадает")
+
+	recorder = get("/api/urls/qrID/qr?format=svg&margin=0", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "image/svg+xml", recorder.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(recorder.Body.String(), "<svg"))
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/urls/qrID/qr?size=5000", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/urls/qrID/qr?format=gif", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/urls/qrID/qr?bg=blue", "").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/urls/missing/qr", "").Code)
+}
+
+func TestPostShortenWithQR(t *testing.T) {
+	mockService := &MockService{
+		CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
+			return "qrID", nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://print.example/","qr":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.PostShorten(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var resp ResponseJSON
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+
+	const prefix = "data:image/png;base64,"
+	require.True(t, strings.HasPrefix(resp.QRCode, prefix))
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.QRCode, prefix))
+	require.NoError(t, err)
+	_, err = png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+}
+
+func TestPreviewAndInterstitial(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	links := map[string]model.URLModel{
+		"plainID": {ShortURL: "plainID", OriginalURL: "http://xn--e1afmkfd.example:8443/login", CreatedAt: created},
+		"gateID":  {ShortURL: "gateID", OriginalURL: "https://docs.example/", Interstitial: true},
+		"usedID":  {ShortURL: "usedID", OriginalURL: "https://used.example/", MaxClicks: 1, Clicks: 1},
+	}
+	var clicks int
+
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			link, ok := links[id]
+			if !ok {
+				return model.URLModel{}, repository.ErrorNotFound
+			}
+			return link, nil
+		},
+		RegisterClickFunc: func(ctx context.Context, id, variant string) (model.URLModel, error) {
+			clicks++
+			return links[id], nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+
+	recorder := get("/plainID+")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 0, clicks, "предпросмотр не засчитывает переход")
+	body := recorder.Body.String()
+	assert.Contains(t, body, "http://xn--e1afmkfd.example:8443/login")
+	assert.Contains(t, body, "пример.example")
+	assert.Contains(t, body, "01.03.2025")
+	assert.Contains(t, body, "не шифруется")
+	assert.Contains(t, body, "порт 8443")
+	assert.Contains(t, body, `href="/plainID"`)
+
+	recorder = get("/gateID")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 1, clicks)
+	assert.Empty(t, recorder.Header().Get("Location"))
+	assert.Contains(t, recorder.Body.String(), `href="https://docs.example/"`)
+	assert.NotContains(t, recorder.Body.String(), "role=\"alert\"")
+
+	assert.Equal(t, http.StatusNotFound, get("/missing+").Code)
+
+	recorder = get("/usedID+")
+	assert.Equal(t, http.StatusGone, recorder.Code, "предпросмотр исчерпанной ссылки отвечает 410")
+	assert.NotContains(t, recorder.Body.String(), "https://used.example/")
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "preview.html"), []byte(`custom {{.Destination}}`), 0o644))
+
+	templates, err := LoadTemplates(dir)
+	require.NoError(t, err)
+
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return model.URLModel{ShortURL: id, OriginalURL: "https://docs.example/", Disabled: true}, nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithTemplates(templates))
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/someID+", nil))
+	assert.Contains(t, recorder.Body.String(), "Ссылка отключена", "непереопределённый шаблон остаётся встроенным")
+
+	mockService.GetLinkFunc = func(ctx context.Context, id string) (model.URLModel, error) {
+		return model.URLModel{ShortURL: id, OriginalURL: "https://docs.example/"}, nil
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/someID+", nil))
+	assert.Equal(t, "custom https://docs.example/", recorder.Body.String())
+
+	_, err = LoadTemplates(filepath.Join(dir, "missing"))
+	assert.NoError(t, err, "пустой каталог не ошибка")
+}
+
+func TestRedirectTypes(t *testing.T) {
+	type testCase struct {
+		name         string
+		redirectType string
+		status       int
+		cacheControl string
+		bodyContains string
+	}
+
+	tests := []testCase{
+		{name: "По умолчанию сервера", redirectType: "", status: http.StatusFound, cacheControl: temporaryCacheControl},
+		{name: "301", redirectType: model.RedirectMovedPermanently, status: http.StatusMovedPermanently, cacheControl: permanentCacheControl},
+		{name: "307", redirectType: model.RedirectTemporary, status: http.StatusTemporaryRedirect, cacheControl: temporaryCacheControl},
+		{name: "308", redirectType: model.RedirectPermanent, status: http.StatusPermanentRedirect, cacheControl: permanentCacheControl},
+		{name: "meta refresh", redirectType: model.RedirectMetaRefresh, status: http.StatusOK, cacheControl: "no-store",
+			bodyContains: `http-equiv="refresh" content="0; url=https://seo.example/page"`},
+		{name: "JavaScript", redirectType: model.RedirectJavaScript, status: http.StatusOK, cacheControl: "no-store",
+			bodyContains: `window.location.replace("https://seo.example/page")`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := &MockService{
+				GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+					return model.URLModel{ShortURL: id, OriginalURL: "https://seo.example/page", RedirectType: test.redirectType}, nil
+				},
+			}
+
+			handler := NewHandler(mockService, "http://localhost:8080", nil, WithDefaultRedirect(model.RedirectFound))
+			router := chi.NewRouter()
+			router.Get("/{id}", handler.Get)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/seoID", nil))
+
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.cacheControl, recorder.Header().Get("Cache-Control"))
+			if test.bodyContains != "" {
+				assert.Contains(t, recorder.Body.String(), test.bodyContains)
+			} else {
+				assert.Equal(t, "https://seo.example/page", recorder.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRedirectCacheControl(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+
+	type testCase struct {
+		name         string
+		link         model.URLModel
+		cacheControl string
+	}
+
+	tests := []testCase{
+		{name: "Без ограничений", cacheControl: permanentCacheControl},
+		{name: "Персонализированная", link: model.URLModel{QueryParams: map[string]string{"c": "{country}"}}, cacheControl: personalCacheControl},
+		{name: "Лимит переходов", link: model.URLModel{MaxClicks: 10}, cacheControl: temporaryCacheControl},
+		{name: "Срок действия", link: model.URLModel{ExpiresAt: &later}, cacheControl: temporaryCacheControl},
+		{name: "Начало активности", link: model.URLModel{ActiveFrom: &earlier}, cacheControl: temporaryCacheControl},
+		{name: "Конец активности", link: model.URLModel{ActiveUntil: &later}, cacheControl: temporaryCacheControl},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := &MockService{
+				GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+					link := test.link
+					link.ShortURL = id
+					link.OriginalURL = "https://seo.example/page"
+					link.RedirectType = model.RedirectMovedPermanently
+					return link, nil
+				},
+			}
+
+			handler := NewHandler(mockService, "http://localhost:8080", nil)
+			router := chi.NewRouter()
+			router.Get("/{id}", handler.Get)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/seoID", nil))
+
+			assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+			assert.Equal(t, test.cacheControl, recorder.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestHeadDoesNotCountClick(t *testing.T) {
+	link := model.URLModel{ShortURL: "headID", OriginalURL: "https://files.example/", MaxClicks: 1}
+	var clicks int
+
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+		RegisterClickFunc: func(ctx context.Context, id, variant string) (model.URLModel, error) {
+			clicks++
+			link.Clicks++
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+	router.Head("/{id}", handler.Get)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/headID", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+	assert.Equal(t, "https://files.example/", recorder.Header().Get("Location"))
+	assert.Equal(t, 0, clicks)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/headID", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+	assert.Equal(t, 1, clicks)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/headID", nil))
+	assert.Equal(t, http.StatusGone, recorder.Code, "исчерпанная ссылка и для HEAD отвечает 410")
+	assert.Equal(t, 1, clicks)
+}
+
+func TestRoutingRules(t *testing.T) {
+	link := model.URLModel{
+		ShortURL:    "appID",
+		OriginalURL: "https://app.example/",
+		Rules: []model.Rule{
+			{Destination: "https://app.example/de", Countries: []string{"DE"}},
+			{Destination: "https://apps.apple.com/app", OS: []string{"ios"}},
+			{Destination: "https://play.google.com/app", OS: []string{"android"}},
+		},
+	}
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithCountryFunc(func(r *http.Request) string {
+		if r.RemoteAddr == "198.51.100.7:1234" {
+			return "DE"
+		}
+		return ""
+	}))
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+
+	type testCase struct {
+		userAgent  string
+		remoteAddr string
+		location   string
+	}
+
+	tests := []testCase{
+		{userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", location: "https://apps.apple.com/app"},
+		{userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8)", location: "https://play.google.com/app"},
+		{userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8)", remoteAddr: "198.51.100.7:1234", location: "https://app.example/de"},
+		{userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", location: "https://app.example/"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/appID", nil)
+		req.Header.Set("User-Agent", test.userAgent)
+		if test.remoteAddr != "" {
+			req.RemoteAddr = test.remoteAddr
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+		assert.Equal(t, test.location, recorder.Header().Get("Location"), test.userAgent)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	link := model.URLModel{
+		ShortURL:    "abID",
+		OriginalURL: "https://landing.example/",
+		Variants: []model.Variant{
+			{ID: "a", Destination: "https://a.example/", Weight: 1},
+			{ID: "b", Destination: "https://b.example/", Weight: 1},
+		},
+	}
+	counted := map[string]int{}
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+		RegisterClickFunc: func(ctx context.Context, id, variant string) (model.URLModel, error) {
+			counted[variant]++
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+	router.Head("/{id}", handler.Get)
+
+	// Без засчитанного перехода посетителю cookie не выдаётся.
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodHead, "/abID", nil),
+		httptest.NewRequest(http.MethodGet, "/abID+", nil),
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		require.Less(t, recorder.Code, http.StatusBadRequest, req.Method+" "+req.URL.Path)
+		assert.Empty(t, recorder.Result().Cookies(), req.Method+" "+req.URL.Path)
+	}
+	assert.Empty(t, counted)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/abID", nil))
+	require.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "vid", cookies[0].Name)
+	first := recorder.Header().Get("Location")
+
+	// С тем же cookie посетитель всегда попадает на тот же вариант.
+	for range 5 {
+		req := httptest.NewRequest(http.MethodGet, "/abID", nil)
+		req.AddCookie(cookies[0])
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, first, recorder.Header().Get("Location"))
+		assert.Empty(t, recorder.Result().Cookies())
+	}
+
+	variant := "a"
+	if first == "https://b.example/" {
+		variant = "b"
+	}
+	assert.Equal(t, map[string]int{variant: 6}, counted)
+
+	// Разные посетители распределяются между вариантами.
+	seen := map[string]bool{}
+	for i := range 50 {
+		req := httptest.NewRequest(http.MethodGet, "/abID", nil)
+		req.AddCookie(&http.Cookie{Name: "vid", Value: fmt.Sprintf("visitor-%d", i)})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		seen[recorder.Header().Get("Location")] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestQueryParams(t *testing.T) {
+	link := model.URLModel{
+		ShortURL:      "utmID",
+		OriginalURL:   "https://shop.example/item?utm_source=site#reviews",
+		QueryParams:   map[string]string{"utm_source": "newsletter", "utm_campaign": "{id}-{country}"},
+		QueryConflict: model.QueryOverride,
+	}
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithCountryFunc(func(r *http.Request) string {
+		return "DE"
+	}))
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/utmID?gclid=42", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+	assert.Equal(t, "https://shop.example/item?utm_campaign=utmID-DE&utm_source=newsletter#reviews", recorder.Header().Get("Location"))
+
+	link.ForwardQuery = true
+	link.QueryConflict = ""
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/utmID?gclid=42&utm_source=ad", nil))
+	assert.Equal(t, "https://shop.example/item?utm_source=site&utm_campaign=utmID-DE&gclid=42#reviews", recorder.Header().Get("Location"))
+}
+
+func TestActivationWindow(t *testing.T) {
+	from := time.Now().Add(time.Hour)
+	link := model.URLModel{
+		ShortURL:    "launchID",
+		OriginalURL: "https://launch.example/",
+		ActiveFrom:  &from,
+		FallbackURL: "https://launch.example/soon",
+	}
+	mockService := &MockService{
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			return link, nil
+		},
+		RegisterClickFunc: func(ctx context.Context, id, variant string) (model.URLModel, error) {
+			t.Error("переход вне окна активности не засчитывается")
+			return link, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.Get)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/launchID", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+	assert.Equal(t, "https://launch.example/soon", recorder.Header().Get("Location"))
+	assert.Equal(t, "private, no-cache", recorder.Header().Get("Cache-Control"))
+
+	link.FallbackURL = ""
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/launchID+", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestListURLs(t *testing.T) {
+	var received service.ListOptions
+	mockService := &MockService{
+		ListLinksFunc: func(ctx context.Context, userID string, opts service.ListOptions) (service.LinkPage, error) {
+			if opts.State == "paused" {
+				return service.LinkPage{}, service.ErrorInvalidOptions
+			}
+			received = opts
+			page := service.LinkPage{Links: []model.URLModel{{ShortURL: "abc", OriginalURL: "https://a.example/", UserID: userID, Version: 1}}}
+			if opts.Cursor == "" {
+				page.NextCursor = "next"
+			}
+			return page, nil
+		},
+	}
+
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?state=active", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), "owner"))
+	recorder := httptest.NewRecorder()
+	handler.ListURLs(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var links []LinkResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&links))
+	require.Len(t, links, 1)
+	assert.Equal(t, "http://localhost:8080/abc", links[0].ShortURL)
+	assert.Equal(t, model.StateActive, links[0].State)
+	assert.Equal(t, `</api/user/urls?cursor=next&state=active>; rel="next"`, recorder.Header().Get("Link"))
+	assert.Equal(t, 100, received.Limit)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/user/urls?cursor=next&sort=clicks&order=asc&limit=5"+
+		"&domain=a.example&created_from=2026-01-01T00:00:00Z&created_to=2026-02-01T00:00:00%2B03:00", nil)
+	recorder = httptest.NewRecorder()
+	handler.ListURLs(recorder, req.WithContext(auth.WithUserID(req.Context(), "owner")))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Link"))
+	assert.Equal(t, "next", received.Cursor)
+	assert.Equal(t, "clicks", received.Sort)
+	assert.Equal(t, "asc", received.Order)
+	assert.Equal(t, 5, received.Limit)
+	assert.Equal(t, "a.example", received.Domain)
+	require.NotNil(t, received.CreatedFrom)
+	require.NotNil(t, received.CreatedTo)
+	assert.True(t, received.CreatedFrom.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, received.CreatedTo.Equal(time.Date(2026, 1, 31, 21, 0, 0, 0, time.UTC)))
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=ten", "created_from=yesterday"} {
+		recorder = httptest.NewRecorder()
+		handler.ListURLs(recorder, httptest.NewRequest(http.MethodGet, "/api/user/urls?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ListURLs(recorder, httptest.NewRequest(http.MethodGet, "/api/user/urls?state=paused", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	mockService := &MockService{
+		CreateAPIKeyFunc: func(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (model.APIKey, string, error) {
+			return model.APIKey{ID: "k1", UserID: userID, Name: name, Scopes: scopes, Hash: "secret-hash"}, "sk_k1_secret", nil
+		},
+		ListAPIKeysFunc: func(ctx context.Context, userID string) ([]model.APIKey, error) {
+			return []model.APIKey{{ID: "k1", UserID: userID, Scopes: []string{auth.ScopeLinksRead}, Hash: "secret-hash"}}, nil
+		},
+		RevokeAPIKeyFunc: func(ctx context.Context, userID, id string) error {
+			if id != "k1" {
+				return service.ErrorAPIKeyNotFound
+			}
+			return nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+
+	session := func(req *http.Request) *http.Request {
+		ctx := auth.WithScopes(auth.WithUserID(req.Context(), "owner"), auth.SessionScopes)
+		return req.WithContext(ctx)
+	}
+	withKey := func(req *http.Request, scopes ...string) *http.Request {
+		ctx := auth.WithScopes(auth.WithUserID(req.Context(), "owner"), scopes)
+		return req.WithContext(auth.WithAPIKeyID(ctx, "k0"))
+	}
+	create := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.PostAPIKey(recorder, session(create(`{"name":"ci","scopes":["links:write"]}`)))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	assert.NotContains(t, recorder.Body.String(), "secret-hash")
+	var created APIKeyResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&created))
+	assert.Equal(t, "sk_k1_secret", created.Key)
+
+	recorder = httptest.NewRecorder()
+	handler.PostAPIKey(recorder, session(create(`{"scopes":["admin"]}`)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "сессия без admin не выдаёт admin")
+
+	recorder = httptest.NewRecorder()
+	handler.PostAPIKey(recorder, withKey(create(`{"scopes":["links:read"]}`), auth.ScopeLinksWrite, auth.ScopeLinksRead))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "обычный ключ не выпускает ключи")
+
+	recorder = httptest.NewRecorder()
+	handler.PostAPIKey(recorder, withKey(create(`{"scopes":["admin"]}`), auth.ScopeAdmin))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ListAPIKeys(recorder, session(httptest.NewRequest(http.MethodGet, "/api/keys", nil)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "secret-hash")
+	assert.NotContains(t, recorder.Body.String(), `"key"`)
+
+	router := chi.NewRouter()
+	router.Delete("/api/keys/{keyID}", handler.DeleteAPIKey)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, session(httptest.NewRequest(http.MethodDelete, "/api/keys/k1", nil)))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, session(httptest.NewRequest(http.MethodDelete, "/api/keys/k2", nil)))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestInternalAPI(t *testing.T) {
+	deletedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	links := map[string]model.URLModel{
+		"abc": {ShortURL: "abc", OriginalURL: "https://example.com", UserID: "u1", Clicks: 7, PasswordHash: "hash"},
+		"old": {ShortURL: "old", OriginalURL: "https://example.org", UserID: "u2", DeletedAt: &deletedAt},
+	}
+	mockService := &MockService{
+		TotalsFunc: func(ctx context.Context) (repository.Totals, error) {
+			return repository.Totals{URLs: 1, Users: 1}, nil
+		},
+		LookupLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			link, ok := links[id]
+			if !ok {
+				return model.URLModel{}, repository.ErrorNotFound
+			}
+			return link, nil
+		},
+		SetLinkDisabledFunc: func(ctx context.Context, id string, disabled bool, reason string) (model.URLModel, error) {
+			link := links[id]
+			link.Disabled = disabled
+			link.DisabledReason = reason
+			return link, nil
+		},
+		DeleteUserLinksFunc: func(ctx context.Context, userID string) (int64, error) {
+			return 3, nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil, WithConfig(map[string]string{"SecretKey": "xxxxx"}))
+
+	router := chi.NewRouter()
+	router.Get("/api/internal/stats", handler.InternalStats)
+	router.Get("/api/internal/urls/{id}", handler.InternalGetURL)
+	router.Post("/api/internal/urls/{id}/disable", handler.InternalDisableURL)
+	router.Post("/api/internal/urls/{id}/enable", handler.InternalEnableURL)
+	router.Delete("/api/internal/users/{userID}/urls", handler.InternalDeleteUserURLs)
+	router.Get("/api/internal/config", handler.InternalConfig)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/api/internal/stats", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"urls":1,"users":1}`, recorder.Body.String())
+
+	recorder = serve(http.MethodGet, "/api/internal/urls/abc", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var link AdminLinkResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&link))
+	assert.Equal(t, "u1", link.UserID)
+	assert.Equal(t, int64(7), link.Clicks)
+	assert.True(t, link.HasPassword)
+	assert.NotContains(t, recorder.Body.String(), `"hash"`, "хеш пароля не отдаётся")
+
+	recorder = serve(http.MethodGet, "/api/internal/urls/old", "")
+	require.Equal(t, http.StatusOK, recorder.Code, "удалённая ссылка видна администратору")
+	assert.Contains(t, recorder.Body.String(), `"deleted_at":"2026-01-02T03:04:05Z"`)
+
+	recorder = serve(http.MethodGet, "/api/internal/urls/missing", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(http.MethodPost, "/api/internal/urls/abc/disable", `{"reason":"phishing"}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&link))
+	assert.True(t, link.Disabled)
+	assert.Equal(t, "phishing", link.DisabledReason)
+
+	recorder = serve(http.MethodPost, "/api/internal/urls/abc/disable", "")
+	assert.Equal(t, http.StatusOK, recorder.Code, "причина необязательна")
+
+	recorder = serve(http.MethodPost, "/api/internal/urls/abc/disable", `{"why":"x"}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serve(http.MethodPost, "/api/internal/urls/abc/enable", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&link))
+	assert.False(t, link.Disabled)
+
+	recorder = serve(http.MethodDelete, "/api/internal/users/u1/urls", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"deleted":3}`, recorder.Body.String())
+
+	recorder = serve(http.MethodGet, "/api/internal/config", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"SecretKey":"xxxxx"}`, recorder.Body.String())
+}
+
+func TestDeleteURL(t *testing.T) {
+	mockService := &MockService{
+		DeleteLinkFunc: func(ctx context.Context, id, userID string) error {
+			if userID != "owner" {
+				return service.ErrorForbidden
+			}
+			return nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Delete("/api/urls/{id}", handler.DeleteURL)
+
+	for userID, status := range map[string]int{"owner": http.StatusNoContent, "intruder": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/urls/abc", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, status, recorder.Code, userID)
+	}
+}
+
+func TestTagEndpoints(t *testing.T) {
+	link := model.URLModel{ShortURL: "abc", OriginalURL: "https://a.example/", UserID: "owner", Version: 3}
+	mockService := &MockService{
+		AddTagsFunc: func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+			if tags[0] == "bad tag" {
+				return model.URLModel{}, service.ErrorInvalidOptions
+			}
+			link.Tags = tags
+			return link, nil
+		},
+		RemoveTagsFunc: func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+			if userID != "owner" {
+				return model.URLModel{}, service.ErrorForbidden
+			}
+			assert.Equal(t, []string{"promo"}, tags)
+			link.Tags = nil
+			return link, nil
+		},
+		ListTagsFunc: func(ctx context.Context, userID string) ([]repository.TagStats, error) {
+			return []repository.TagStats{{Tag: "promo", Links: 2, Clicks: 7}}, nil
+		},
+		TagStatsFunc: func(ctx context.Context, userID, tag string) (repository.TagStats, error) {
+			if tag != "promo" {
+				return repository.TagStats{}, service.ErrorTagNotFound
+			}
+			return repository.TagStats{Tag: tag, Links: 2, Clicks: 7}, nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	router := chi.NewRouter()
+	router.Post("/api/urls/{id}/tags", handler.PostTags)
+	router.Delete("/api/urls/{id}/tags/{tag}", handler.DeleteTag)
+	router.Get("/api/user/tags", handler.ListTags)
+	router.Get("/api/user/tags/{tag}/stats", handler.GetTagStats)
+
+	serve := func(method, target, body, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "/api/urls/abc/tags", `{"tags":["promo","spring"]}`, "owner")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `"v3"`, recorder.Header().Get("ETag"))
+	var resp LinkResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, []string{"promo", "spring"}, resp.Tags)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, serve(http.MethodPost, "/api/urls/abc/tags", `{"tags":["bad tag"]}`, "owner").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/urls/abc/tags", `{"labels":["promo"]}`, "owner").Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(http.MethodPost, "/api/urls/abc/tags", "", "owner").Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/api/urls/abc/tags/promo", "", "intruder").Code)
+	recorder = serve(http.MethodDelete, "/api/urls/abc/tags/promo", "", "owner")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), `"tags"`)
+
+	recorder = serve(http.MethodGet, "/api/user/tags", "", "owner")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `[{"tag":"promo","links":2,"clicks":7}]`, recorder.Body.String())
+
+	recorder = serve(http.MethodGet, "/api/user/tags/promo/stats", "", "owner")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"tag":"promo","links":2,"clicks":7}`, recorder.Body.String())
+
+	recorder = serve(http.MethodGet, "/api/user/tags/spring/stats", "", "owner")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Tag not found")
+}
+
+func TestDashboard(t *testing.T) {
+	links := map[string]model.URLModel{}
+	for i := range 25 {
+		id := fmt.Sprintf("l%02d", i)
+		links[id] = model.URLModel{ShortURL: id, OriginalURL: "https://example.com/" + id, UserID: "owner", Version: 1, Clicks: int64(i)}
+	}
+	l03 := links["l03"]
+	l03.Tags = []string{"promo"}
+	links["l03"] = l03
+	var created service.CreateOptions
+	var patch service.LinkPatch
+	var deleted string
+	var tagged, untagged []string
+	mockService := &MockService{
+		ListLinksFunc: func(ctx context.Context, userID string, opts service.ListOptions) (service.LinkPage, error) {
+			// Курсор в заглушке — идентификатор последней ссылки страницы.
+			var result service.LinkPage
+			for i := range 25 {
+				link, ok := links[fmt.Sprintf("l%02d", i)]
+				if !ok || link.UserID != userID || link.ShortURL <= opts.Cursor ||
+					(opts.Tag != "" && !slices.Contains(link.Tags, opts.Tag)) ||
+					!strings.Contains(link.ShortURL, strings.ToLower(opts.Search)) {
+					continue
+				}
+				if len(result.Links) == opts.Limit {
+					result.NextCursor = result.Links[len(result.Links)-1].ShortURL
+					break
+				}
+				result.Links = append(result.Links, link)
+			}
+			return result, nil
+		},
+		GetLinkFunc: func(ctx context.Context, id string) (model.URLModel, error) {
+			link, ok := links[id]
+			if !ok {
+				return model.URLModel{}, repository.ErrorNotFound
+			}
+			return link, nil
+		},
+		CreateShortURLFunc: func(ctx context.Context, originalURL string, opts service.CreateOptions) (string, error) {
+			if opts.Alias == "taken" {
+				return "", repository.ErrorAlreadyExists
+			}
+			created = opts
+			return opts.Alias, nil
+		},
+		UpdateLinkFunc: func(ctx context.Context, id, userID string, version int64, p service.LinkPatch) (model.URLModel, error) {
+			if version != links[id].Version {
+				return model.URLModel{}, repository.ErrorConflict
+			}
+			patch = p
+			return links[id], nil
+		},
+		DeleteLinkFunc: func(ctx context.Context, id, userID string) error {
+			deleted = id
+			return nil
+		},
+		AddTagsFunc: func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+			tagged = tags
+			return links[id], nil
+		},
+		RemoveTagsFunc: func(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+			untagged = tags
+			return links[id], nil
+		},
+	}
+	handler := NewHandler(mockService, "http://localhost:8080", nil)
+	signer := auth.NewSigner("secret")
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), "owner")))
+		})
+	})
+	router.Use(middleware.CSRF(signer))
+	router.Get("/dashboard", handler.Dashboard)
+	router.Post("/dashboard/links", handler.DashboardCreate)
+	router.Get("/dashboard/links/{id}", handler.DashboardLink)
+	router.Post("/dashboard/links/{id}", handler.DashboardUpdate)
+	router.Post("/dashboard/links/{id}/delete", handler.DashboardDelete)
+	router.Post("/dashboard/links/{id}/tags", handler.DashboardAddTags)
+	router.Post("/dashboard/links/{id}/tags/remove", handler.DashboardRemoveTag)
+
+	token := signer.Sign("csrf:owner")
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+	post := func(target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/dashboard")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, token)
+	assert.Equal(t, "DENY", recorder.Header().Get("X-Frame-Options"))
+	assert.Contains(t, body, `href="/dashboard?cursor=l19"`)
+	assert.NotContains(t, body, `rel="first"`)
+	assert.NotContains(t, body, "/dashboard/links/l20\"")
+
+	recorder = get("/dashboard?cursor=l19")
+	body = recorder.Body.String()
+	assert.Contains(t, body, "/dashboard/links/l24")
+	assert.Contains(t, body, `<a href="/dashboard" rel="first">`)
+	assert.NotContains(t, body, `rel="next"`)
+
+	recorder = get("/dashboard?q=L03")
+	body = recorder.Body.String()
+	assert.Contains(t, body, "/dashboard/links/l03")
+	assert.NotContains(t, body, "/dashboard/links/l04")
+
+	recorder = get("/dashboard?tag=promo")
+	body = recorder.Body.String()
+	assert.Contains(t, body, "/dashboard/links/l03")
+	assert.NotContains(t, body, "/dashboard/links/l04")
+	assert.Contains(t, body, `<a class="tag" href="/dashboard?tag=promo">promo</a>`)
+	assert.Contains(t, body, `<input type="hidden" name="tag" value="promo">`)
+
+	recorder = post("/dashboard/links", url.Values{"url": {"https://example.com"}, "alias": {"promo"}})
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "без CSRF-токена")
+
+	recorder = post("/dashboard/links", url.Values{"csrf_token": {token}, "url": {"https://example.com"}, "expires_at": {"tomorrow"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Invalid link options")
+	assert.NotContains(t, recorder.Body.String(), "invalid link options:", "текст ошибки сервиса не раскрывается")
+
+	recorder = post("/dashboard/links", url.Values{
+		"csrf_token": {token}, "url": {"https://example.com"}, "alias": {"promo"}, "expires_at": {"2030-01-02T03:04"},
+		"tags": {" spring, ,sale "},
+	})
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/dashboard?created=promo", recorder.Header().Get("Location"))
+	assert.Equal(t, "owner", created.UserID)
+	require.NotNil(t, created.ExpiresAt)
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC), *created.ExpiresAt)
+	assert.Equal(t, []string{"spring", "sale"}, created.Tags)
+
+	recorder = post("/dashboard/links", url.Values{"csrf_token": {token}, "url": {"https://example.com"}, "alias": {"taken"}})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Псевдоним уже занят")
+	assert.Contains(t, recorder.Body.String(), `value="taken"`, "введённые значения сохраняются")
+
+	recorder = get("/dashboard/links/l07")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `<td class="clicks">7</td>`)
+
+	links["alien"] = model.URLModel{ShortURL: "alien", UserID: "intruder"}
+	recorder = get("/dashboard/links/alien")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = post("/dashboard/links/l07", url.Values{"csrf_token": {token}, "version": {"1"}, "url": {"https://example.org"}, "expires_at": {""}})
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	require.NotNil(t, patch.OriginalURL)
+	assert.Equal(t, "https://example.org", *patch.OriginalURL)
+	assert.False(t, patch.ClearExpiry, "срок не менялся")
+
+	recorder = post("/dashboard/links/l07", url.Values{"csrf_token": {token}, "version": {"0"}, "url": {"https://example.org"}})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = post("/dashboard/links/l07/tags", url.Values{"csrf_token": {token}, "tags": {"a, b"}})
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/dashboard/links/l07?tagged=1", recorder.Header().Get("Location"))
+	assert.Equal(t, []string{"a", "b"}, tagged)
+
+	recorder = post("/dashboard/links/l03/tags/remove", url.Values{"csrf_token": {token}, "tag": {"promo"}})
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, []string{"promo"}, untagged)
+
+	recorder = post("/dashboard/links/l07/delete", url.Values{"csrf_token": {token}})
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "l07", deleted)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Обработчики внутреннего API (/api/internal/*). Проверка доступа — в
+// middleware.TrustedSubnetOrAdminKey, владелец ссылок здесь не учитывается.
+
+// AdminLinkResponse дополняет LinkResponse полями, которые видит только
+// администратор.
+type AdminLinkResponse struct {
+	LinkResponse
+	UserID         string     `json:"user_id,omitempty"`
+	Clicks         int64      `json:"clicks"`
+	MaxClicks      int64      `json:"max_clicks,omitempty"`
+	HasPassword    bool       `json:"has_password"`
+	Disabled       bool       `json:"disabled"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+type DisableRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) adminLinkResponse(link model.URLModel) AdminLinkResponse {
+	return AdminLinkResponse{
+		LinkResponse:   h.linkResponse(link),
+		UserID:         link.UserID,
+		Clicks:         link.Clicks,
+		MaxClicks:      link.MaxClicks,
+		HasPassword:    link.PasswordHash != "",
+		Disabled:       link.Disabled,
+		DisabledReason: link.DisabledReason,
+		DeletedAt:      link.DeletedAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) InternalStats(w http.ResponseWriter, r *http.Request) {
+	totals, err := h.service.Totals(r.Context())
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, totals)
+}
+
+func (h *Handler) InternalGetURL(w http.ResponseWriter, r *http.Request) {
+	link, err := h.service.LookupLink(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.adminLinkResponse(link))
+}
+
+// InternalDisableURL принудительно отключает ссылку. Тело с причиной
+// необязательно.
+func (h *Handler) InternalDisableURL(w http.ResponseWriter, r *http.Request) {
+	var req DisableRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	decoder.DisallowUnknownFields()
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if isBodyTooLarge(err) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large", nil)
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Failed to decode request body", err.Error())
+		return
+	}
+
+	h.setDisabled(w, r, true, req.Reason)
+}
+
+func (h *Handler) InternalEnableURL(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false, "")
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool, reason string) {
+	link, err := h.service.SetLinkDisabled(r.Context(), chi.URLParam(r, "id"), disabled, reason)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.adminLinkResponse(link))
+}
+
+func (h *Handler) InternalDeleteUserURLs(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.service.DeleteUserLinks(r.Context(), chi.URLParam(r, "userID"))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
+
+func (h *Handler) InternalConfig(w http.ResponseWriter, r *http.Request) {
+	if h.config == nil {
+		writeJSONError(w, r, http.StatusNotFound, CodeNotFound, "Configuration is not available", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.config)
+}
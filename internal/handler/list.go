@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// ListURLs отдаёт страницу ссылок текущего пользователя. Параметры:
+// state (scheduled, active, expired, deleted), tag, domain, created_from и
+// created_to (RFC 3339), sort (created, clicks), order (desc, asc), limit и
+// cursor. Адрес следующей страницы передаётся в заголовке Link с rel="next".
+func (h *Handler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := service.ListOptions{
+		State:  query.Get("state"),
+		Tag:    query.Get("tag"),
+		Domain: query.Get("domain"),
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Cursor: query.Get("cursor"),
+		Limit:  defaultListLimit,
+	}
+
+	for _, param := range []struct {
+		name  string
+		value **time.Time
+	}{
+		{"created_from", &opts.CreatedFrom},
+		{"created_to", &opts.CreatedTo},
+	} {
+		raw := query.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, param.name+" must be an RFC 3339 timestamp", err.Error())
+			return
+		}
+		*param.value = &t
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest,
+				fmt.Sprintf("limit must be an integer from 1 to %d", maxListLimit), nil)
+			return
+		}
+		opts.Limit = limit
+	}
+
+	ctx := r.Context()
+	page, err := h.service.ListLinks(ctx, auth.UserIDFromContext(ctx), opts)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	resp := make([]LinkResponse, 0, len(page.Links))
+	for _, link := range page.Links {
+		resp = append(resp, h.linkResponse(link))
+	}
+
+	if page.NextCursor != "" {
+		query.Set("cursor", page.NextCursor)
+		next := *r.URL
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
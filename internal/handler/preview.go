@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const previewSuffix = "+"
+
+type previewPage struct {
+	ShortURL      string
+	Destination   string
+	Domain        string
+	UnicodeDomain string
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time
+	Warnings      []string
+	ContinueURL   string
+}
+
+// newPreviewPage собирает данные страницы предпросмотра. continueURL — куда
+// ведёт кнопка: на "/{id}" для предпросмотра, чтобы переход был засчитан,
+// или сразу на адрес назначения, если переход уже засчитан.
+func (h *Handler) newPreviewPage(link model.URLModel, continueURL string) previewPage {
+	page := previewPage{
+		ShortURL:    fmt.Sprintf("%s/%s", h.baseURL, link.ShortURL),
+		Destination: link.OriginalURL,
+		CreatedAt:   link.CreatedAt,
+		ExpiresAt:   link.ExpiresAt,
+		ContinueURL: continueURL,
+	}
+
+	u, err := url.Parse(link.OriginalURL)
+	if err != nil {
+		page.Warnings = append(page.Warnings, "Адрес назначения не удалось разобрать.")
+		return page
+	}
+
+	host := u.Hostname()
+	page.Domain = host
+	if unicode, err := idna.Display.ToUnicode(host); err == nil && unicode != host {
+		page.UnicodeDomain = unicode
+	}
+	page.Warnings = destinationWarnings(u, page.UnicodeDomain)
+
+	return page
+}
+
+func destinationWarnings(u *url.URL, unicodeDomain string) []string {
+	var warnings []string
+
+	if u.Scheme != "https" {
+		warnings = append(warnings, "Соединение с сайтом назначения не шифруется: данные, которые вы введёте, могут перехватить.")
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		warnings = append(warnings, "Сайт указан IP-адресом, а не доменным именем.")
+	}
+	if unicodeDomain != "" || strings.Contains(u.Hostname(), "xn--") {
+		warnings = append(warnings, "Домен содержит символы национальных алфавитов. Похожие на латиницу буквы часто используют для подделки известных сайтов.")
+	}
+	if u.Port() != "" {
+		warnings = append(warnings, fmt.Sprintf("Используется нестандартный порт %s.", u.Port()))
+	}
+
+	return warnings
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/qr"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Содержимое кода зависит только от адреса ссылки и параметров, поэтому его
+// можно кешировать надолго.
+const qrCacheControl = "public, max-age=86400"
+
+func (h *Handler) GetQR(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid QR code parameters", err.Error())
+		return
+	}
+
+	link, err := h.service.GetLink(r.Context(), id)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	content := fmt.Sprintf("%s/%s", h.baseURL, link.ShortURL)
+	tag := qrETag(content, opts)
+
+	w.Header().Set("Cache-Control", qrCacheControl)
+	w.Header().Set("ETag", tag)
+	if etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	image, err := qr.Render(content, opts)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid QR code parameters", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
+
+func parseQROptions(query url.Values) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: size must be an integer", qr.ErrorInvalidOptions)
+		}
+		opts.Size = size
+	}
+	if v := query.Get("format"); v != "" {
+		opts.Format = strings.ToLower(v)
+	}
+	if v := query.Get("ecc"); v != "" {
+		opts.Level = strings.ToUpper(v)
+	}
+	if v := query.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: margin must be an integer", qr.ErrorInvalidOptions)
+		}
+		opts.Margin = margin
+	}
+	if v := query.Get("fg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Foreground = c
+	}
+	if v := query.Get("bg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+
+	return opts, opts.Validate()
+}
+
+// etagMatches сообщает, есть ли tag в списке If-None-Match. Теги сравниваются
+// целиком и без учёта признака W/, как требует слабое сравнение RFC 9110.
+func etagMatches(header, tag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func qrETag(content string, opts qr.Options) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%+v", content, opts)))
+	return `"qr-` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// qrDataURI возвращает PNG-код с параметрами по умолчанию в виде data URI.
+func qrDataURI(content string) (string, error) {
+	opts := qr.DefaultOptions()
+	image, err := qr.Render(content, opts)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + opts.ContentType() + ";base64," + base64.StdEncoding.EncodeToString(image), nil
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/rules"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Постоянные перенаправления браузеры кешируют сами; ограничиваем срок,
+	// чтобы изменение адреса назначения всё же дошло до посетителей.
+	permanentCacheControl = "public, max-age=86400"
+	temporaryCacheControl = "private, no-cache"
+	// Если адрес зависит от посетителя, общие кеши не должны его хранить.
+	personalCacheControl = "private, max-age=86400"
+
+	visitorCookieName = "vid"
+	visitorCookieTTL  = 365 * 24 * time.Hour
+)
+
+var redirectStatuses = map[string]int{
+	model.RedirectMovedPermanently: http.StatusMovedPermanently,
+	model.RedirectFound:            http.StatusFound,
+	model.RedirectTemporary:        http.StatusTemporaryRedirect,
+	model.RedirectPermanent:        http.StatusPermanentRedirect,
+}
+
+type redirectPage struct {
+	URL        string
+	JavaScript bool
+}
+
+// route подставляет в OriginalURL адрес, на который нужно отправить
+// посетителя: первого подходящего правила, а если правила не подошли —
+// варианта A/B-разделения. К адресу добавляются параметры запроса ссылки.
+// Второе значение — идентификатор выбранного варианта. Новому посетителю
+// cookie выдаётся, только если click: переход действительно засчитывается.
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, link model.URLModel, click bool) (model.URLModel, string) {
+	country := sync.OnceValue(func() string {
+		if h.country == nil {
+			return ""
+		}
+		return h.country(r)
+	})
+
+	var variantID string
+	matched := false
+	if len(link.Rules) > 0 {
+		if destination, ok := rules.Match(link.Rules, rules.NewRequest(r, country())); ok {
+			link.OriginalURL = destination
+			matched = true
+		}
+	}
+
+	if !matched && len(link.Variants) > 0 {
+		variant, ok := rules.PickVariant(h.visitorID(w, r, click)+"|"+link.ShortURL, link.Variants)
+		if ok {
+			link.OriginalURL = variant.Destination
+			variantID = variant.ID
+		}
+	}
+
+	if len(link.QueryParams) > 0 || link.ForwardQuery {
+		link.OriginalURL = withQuery(r, link, map[string]string{
+			"id":      link.ShortURL,
+			"variant": variantID,
+			"country": country(),
+		})
+	}
+	return link, variantID
+}
+
+// withQuery добавляет к адресу назначения параметры из шаблонов ссылки и,
+// если включено, параметры запроса к короткой ссылке.
+func withQuery(r *http.Request, link model.URLModel, vars map[string]string) string {
+	destination := link.OriginalURL
+	sources := [][]rules.Param{rules.ExpandParams(link.QueryParams, vars)}
+	if link.ForwardQuery {
+		sources = append(sources, rules.ParseQuery(r.URL.RawQuery))
+	}
+
+	for _, params := range sources {
+		merged, err := rules.MergeQuery(destination, params, link.QueryConflict)
+		if err != nil {
+			logger.FromContext(r.Context()).Warn("Не удалось добавить параметры к адресу назначения",
+				zap.String("id", link.ShortURL), zap.Error(err))
+			return destination
+		}
+		destination = merged
+	}
+	return destination
+}
+
+// personalized сообщает, зависит ли адрес назначения от посетителя.
+func personalized(link model.URLModel) bool {
+	if len(link.Rules) > 0 || len(link.Variants) > 0 {
+		return true
+	}
+	for _, value := range link.QueryParams {
+		if strings.Contains(value, "{country}") {
+			return true
+		}
+	}
+	return false
+}
+
+// limited сообщает, может ли ссылка перестать вести на адрес назначения
+// раньше, чем истечёт срок кеширования: по числу переходов, сроку действия
+// или окну активности. Такие перенаправления кешировать нельзя, иначе
+// браузер продолжит переходить по уже неактивной ссылке.
+func limited(link model.URLModel) bool {
+	return link.MaxClicks > 0 || link.ExpiresAt != nil || link.ActiveFrom != nil || link.ActiveUntil != nil ||
+		link.Disabled || link.Deleted()
+}
+
+// visitorID возвращает идентификатор посетителя из cookie, выдавая новый при
+// первом визите. Он нужен только для стабильного выбора варианта, поэтому
+// не подписывается. Без assign новый идентификатор не запоминается.
+func (h *Handler) visitorID(w http.ResponseWriter, r *http.Request, assign bool) string {
+	if cookie, err := r.Cookie(visitorCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	id := uuid.New().String()
+	if !assign {
+		return id
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(visitorCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(h.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// redirect отправляет посетителя на адрес назначения способом, выбранным для
+// ссылки, или способом по умолчанию.
+func (h *Handler) redirect(w http.ResponseWriter, link model.URLModel) {
+	redirectType := link.RedirectType
+	if redirectType == "" {
+		redirectType = h.defaultRedirect
+	}
+
+	switch redirectType {
+	case model.RedirectMetaRefresh, model.RedirectJavaScript:
+		h.renderHTML(w, http.StatusOK, "redirect.html", redirectPage{
+			URL:        link.OriginalURL,
+			JavaScript: redirectType == model.RedirectJavaScript,
+		})
+		return
+	}
+
+	status, ok := redirectStatuses[redirectType]
+	if !ok {
+		status = http.StatusTemporaryRedirect
+	}
+
+	cacheControl := temporaryCacheControl
+	if (status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect) && !limited(link) {
+		cacheControl = permanentCacheControl
+		if personalized(link) {
+			cacheControl = personalCacheControl
+		}
+	}
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Location", link.OriginalURL)
+	w.WriteHeader(status)
+}
+
+// inactive отвечает на переход вне окна активности ссылки: отправляет на
+// запасной адрес, если он задан, иначе отвечает 404, не раскрывая, что
+// ссылка существует.
+func (h *Handler) inactive(w http.ResponseWriter, r *http.Request, link model.URLModel) {
+	if link.FallbackURL == "" {
+		writeServiceError(w, r, repository.ErrorNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", temporaryCacheControl)
+	w.Header().Set("Location", link.FallbackURL)
+	w.WriteHeader(http.StatusTemporaryRedirect)
+}
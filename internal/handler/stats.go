@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+type StatsResponse struct {
+	ID              string `json:"id"`
+	ShortURL        string `json:"short_url"`
+	OriginalURL     string `json:"original_url,omitempty"`
+	Clicks          int64  `json:"clicks"`
+	MaxClicks       int64  `json:"max_clicks,omitempty"`
+	RemainingClicks *int64 `json:"remaining_clicks,omitempty"`
+	Disabled        bool   `json:"disabled"`
+	Version         int64  `json:"version"`
+
+	Variants []VariantStats `json:"variants,omitempty"`
+}
+
+type VariantStats struct {
+	ID          string `json:"id"`
+	Destination string `json:"destination,omitempty"`
+	Weight      int    `json:"weight"`
+	Clicks      int64  `json:"clicks"`
+}
+
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx := r.Context()
+	link, err := h.service.LinkStats(ctx, id, auth.UserIDFromContext(ctx))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	resp := StatsResponse{
+		ID:        link.ShortURL,
+		ShortURL:  fmt.Sprintf("%s/%s", h.baseURL, link.ShortURL),
+		Clicks:    link.Clicks,
+		MaxClicks: link.MaxClicks,
+		Disabled:  link.Disabled,
+		Version:   link.Version,
+	}
+
+	// Адрес назначения защищённой ссылки не раскрывается без пароля.
+	if link.PasswordHash == "" {
+		resp.OriginalURL = link.OriginalURL
+	}
+
+	for _, v := range link.Variants {
+		stats := VariantStats{ID: v.ID, Weight: v.Weight, Clicks: v.Clicks}
+		if link.PasswordHash == "" {
+			stats.Destination = v.Destination
+		}
+		resp.Variants = append(resp.Variants, stats)
+	}
+
+	if link.MaxClicks > 0 {
+		remaining := max(link.MaxClicks-link.Clicks, 0)
+		resp.RemainingClicks = &remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(link.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
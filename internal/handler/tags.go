@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+)
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// PostTags добавляет метки ссылке. Версия ссылки не меняется, поэтому
+// If-Match не требуется.
+func (h *Handler) PostTags(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		writeJSONError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Invalid content type", nil)
+		return
+	}
+
+	var req TagsRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	decoder.DisallowUnknownFields()
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large", nil)
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Failed to decode request body", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	link, err := h.service.AddTags(ctx, id, auth.UserIDFromContext(ctx), req.Tags)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(link.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.linkResponse(link))
+}
+
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx := r.Context()
+	link, err := h.service.RemoveTags(ctx, id, auth.UserIDFromContext(ctx), []string{chi.URLParam(r, "tag")})
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(link.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.linkResponse(link))
+}
+
+// ListTags отдаёт метки пользователя с числом ссылок и переходов по ним.
+func (h *Handler) ListTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tags, err := h.service.ListTags(ctx, auth.UserIDFromContext(ctx))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+// GetTagStats отдаёт статистику метки, просуммированную по всем её ссылкам.
+func (h *Handler) GetTagStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := h.service.TagStats(ctx, auth.UserIDFromContext(ctx), chi.URLParam(r, "tag"))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
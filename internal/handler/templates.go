@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var defaultTemplates = template.Must(parseEmbeddedTemplates())
+
+func parseEmbeddedTemplates() (*template.Template, error) {
+	return template.ParseFS(templateFS, "templates/*.html")
+}
+
+// LoadTemplates возвращает встроенные шаблоны страниц, переопределённые
+// одноимёнными *.html из dir. Шаблоны, которых в dir нет, остаются встроенными.
+func LoadTemplates(dir string) (*template.Template, error) {
+	if dir == "" {
+		return defaultTemplates, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(files) == 0 {
+		return defaultTemplates, err
+	}
+
+	// Уже исполнявшиеся html/template нельзя клонировать, поэтому набор
+	// разбирается заново.
+	templates, err := parseEmbeddedTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return templates.ParseFiles(files...)
+}
+
+func (h *Handler) renderHTML(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Формы панели и ввода пароля нельзя встраивать в чужие страницы.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	h.templates.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unlockCookiePrefix = "unlock_"
+
+type passwordPage struct {
+	ID    string
+	Error string
+}
+
+func (h *Handler) unlocked(r *http.Request, id string) bool {
+	cookie, err := r.Cookie(unlockCookiePrefix + id)
+	if err != nil {
+		return false
+	}
+
+	value, ok := h.signer.Verify(cookie.Value)
+	if !ok {
+		return false
+	}
+
+	cookieID, expires, ok := strings.Cut(value, "|")
+	if !ok || cookieID != id {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	return err == nil && time.Now().Unix() < unix
+}
+
+func (h *Handler) setUnlockCookie(w http.ResponseWriter, r *http.Request, id string) {
+	expires := time.Now().Add(h.unlockTTL)
+	value := id + "|" + strconv.FormatInt(expires.Unix(), 10)
+
+	// Cookie нужна и на "/{id}", и на предпросмотре "/{id}+", поэтому путь
+	// общий, а ссылку различает имя.
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + id,
+		Value:    h.signer.Sign(value),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(h.unlockTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(h.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) PostUnlock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "ID cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Request body could not be read", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	_, err := h.service.UnlockLink(ctx, id, r.PostForm.Get("password"))
+	if errors.Is(err, service.ErrorWrongPassword) {
+		h.renderHTML(w, http.StatusUnauthorized, "password.html", passwordPage{ID: id, Error: "Неверный пароль"})
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	h.setUnlockCookie(w, r, id)
+	http.Redirect(w, r, "/"+id, http.StatusSeeOther)
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PatchRequest — тело PATCH /api/urls/{id} в духе JSON merge patch:
+// отсутствующие поля не меняются, null в expires_at, active_from и
+// active_until снимает ограничение, а null в metadata и query_params
+// удаляет ключ.
+type PatchRequest struct {
+	OriginalURL  *string            `json:"original_url"`
+	ExpiresAt    json.RawMessage    `json:"expires_at"`
+	Metadata     map[string]*string `json:"metadata"`
+	Interstitial *bool              `json:"interstitial"`
+	RedirectType *string            `json:"redirect_type"`
+	Rules        json.RawMessage    `json:"rules"`
+	Variants     json.RawMessage    `json:"variants"`
+
+	QueryParams   map[string]*string `json:"query_params"`
+	QueryConflict *string            `json:"query_conflict"`
+	ForwardQuery  *bool              `json:"forward_query"`
+
+	ActiveFrom  json.RawMessage `json:"active_from"`
+	ActiveUntil json.RawMessage `json:"active_until"`
+	FallbackURL *string         `json:"fallback_url"`
+
+	Version *int64 `json:"version"`
+}
+
+type LinkResponse struct {
+	ID           string            `json:"id"`
+	ShortURL     string            `json:"short_url"`
+	OriginalURL  string            `json:"original_url"`
+	Version      int64             `json:"version"`
+	CreatedAt    time.Time         `json:"created_at,omitzero"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Interstitial bool              `json:"interstitial,omitempty"`
+	RedirectType string            `json:"redirect_type,omitempty"`
+	Rules        []model.Rule      `json:"rules,omitempty"`
+	Variants     []model.Variant   `json:"variants,omitempty"`
+
+	QueryParams   map[string]string `json:"query_params,omitempty"`
+	QueryConflict string            `json:"query_conflict,omitempty"`
+	ForwardQuery  bool              `json:"forward_query,omitempty"`
+
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+	State       string     `json:"state"`
+	Tags        []string   `json:"tags,omitempty"`
+}
+
+func etag(version int64) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// parseETag разбирает значение If-Match, выданное etag. Слабые теги
+// принимаются: версия однозначно определяет состояние ссылки.
+func parseETag(value string) (int64, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	value = strings.Trim(value, `"`)
+	if !strings.HasPrefix(value, "v") {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(value[1:], 10, 64)
+	return version, err == nil && version >= 0
+}
+
+func (h *Handler) PatchURL(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		writeJSONError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Invalid content type", nil)
+		return
+	}
+
+	var req PatchRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	decoder.DisallowUnknownFields()
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large", nil)
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "Failed to decode request body", err.Error())
+		return
+	}
+
+	var version int64
+	switch ifMatch := strings.TrimSpace(r.Header.Get("If-Match")); {
+	case ifMatch == "*":
+		// RFC 9110: "*" совпадает с любой текущей версией.
+		version = service.AnyVersion
+	case ifMatch != "":
+		v, ok := parseETag(ifMatch)
+		if !ok {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "If-Match must carry an ETag returned by the API", nil)
+			return
+		}
+		version = v
+	case req.Version != nil:
+		version = *req.Version
+	default:
+		writeJSONError(w, r, http.StatusPreconditionRequired, CodePreconditionRequired,
+			"If-Match header or version field is required", nil)
+		return
+	}
+
+	patch := service.LinkPatch{
+		OriginalURL:  req.OriginalURL,
+		Metadata:     req.Metadata,
+		Interstitial: req.Interstitial,
+		RedirectType: req.RedirectType,
+
+		QueryParams:   req.QueryParams,
+		QueryConflict: req.QueryConflict,
+		ForwardQuery:  req.ForwardQuery,
+		FallbackURL:   req.FallbackURL,
+	}
+	var err error
+	for _, field := range []struct {
+		name  string
+		raw   json.RawMessage
+		value **time.Time
+		clear *bool
+	}{
+		{"expires_at", req.ExpiresAt, &patch.ExpiresAt, &patch.ClearExpiry},
+		{"active_from", req.ActiveFrom, &patch.ActiveFrom, &patch.ClearActiveFrom},
+		{"active_until", req.ActiveUntil, &patch.ActiveUntil, &patch.ClearActiveUntil},
+	} {
+		if *field.value, *field.clear, err = parseTimePatch(field.raw); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, field.name+" must be an RFC 3339 timestamp or null", err.Error())
+			return
+		}
+	}
+
+	// null, как и пустой список, удаляет все правила или варианты.
+	if len(req.Rules) > 0 {
+		var routing []model.Rule
+		if err := decodeStrict(req.Rules, &routing); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "rules must be a list of rules or null", err.Error())
+			return
+		}
+		patch.Rules = &routing
+	}
+	if len(req.Variants) > 0 {
+		var variants []model.Variant
+		if err := decodeStrict(req.Variants, &variants); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, CodeBadRequest, "variants must be a list of variants or null", err.Error())
+			return
+		}
+		patch.Variants = &variants
+	}
+
+	ctx := r.Context()
+	link, err := h.service.UpdateLink(ctx, id, auth.UserIDFromContext(ctx), version, patch)
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(link.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.linkResponse(link))
+}
+
+// parseTimePatch разбирает поле времени из PATCH: отсутствующее поле ничего не
+// меняет, null снимает значение.
+func parseTimePatch(raw json.RawMessage) (*time.Time, bool, error) {
+	if len(raw) == 0 {
+		return nil, false, nil
+	}
+	if bytes.Equal(raw, []byte("null")) {
+		return nil, true, nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, false, err
+	}
+	return &t, false, nil
+}
+
+func decodeStrict(data json.RawMessage, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func (h *Handler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx := r.Context()
+	if err := h.service.DeleteLink(ctx, id, auth.UserIDFromContext(ctx)); err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx := r.Context()
+	history, err := h.service.LinkHistory(ctx, id, auth.UserIDFromContext(ctx))
+	if err != nil {
+		writeServiceJSONError(w, r, err)
+		return
+	}
+	if history == nil {
+		history = []model.HistoryEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+func (h *Handler) linkResponse(link model.URLModel) LinkResponse {
+	return LinkResponse{
+		ID:           link.ShortURL,
+		ShortURL:     fmt.Sprintf("%s/%s", h.baseURL, link.ShortURL),
+		OriginalURL:  link.OriginalURL,
+		Version:      link.Version,
+		CreatedAt:    link.CreatedAt,
+		ExpiresAt:    link.ExpiresAt,
+		Metadata:     link.Metadata,
+		Interstitial: link.Interstitial,
+		RedirectType: link.RedirectType,
+		Rules:        link.Rules,
+		Variants:     link.Variants,
+
+		QueryParams:   link.QueryParams,
+		QueryConflict: link.QueryConflict,
+		ForwardQuery:  link.ForwardQuery,
+
+		ActiveFrom:  link.ActiveFrom,
+		ActiveUntil: link.ActiveUntil,
+		FallbackURL: link.FallbackURL,
+		State:       link.State(time.Now()),
+		Tags:        link.Tags,
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "shortener"
+
+var Registry = prometheus.NewRegistry()
+
+// Доли попаданий в кеш среди метрик нет: у сервиса нет кеша ссылок, каждый
+// переход читает хранилище, и её нечем было бы наполнить. Счётчики попаданий
+// и промахов нужно добавить вместе с самим кешем.
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of processed HTTP requests.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	RepositoryOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_operation_duration_seconds",
+		Help:      "Repository operation latency.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"backend", "operation"})
+
+	RepositoryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_errors_total",
+		Help:      "Number of failed repository operations.",
+	}, []string{"backend", "operation"})
+
+	RedirectsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of redirects served.",
+	})
+
+	LinksCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_created_total",
+		Help:      "Number of short links created.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		RepositoryOperationDuration,
+		RepositoryErrorsTotal,
+		RedirectsTotal,
+		LinksCreatedTotal,
+	)
+}
+
+func RegisterDBStats(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
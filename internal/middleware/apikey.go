@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+type KeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, token string) (model.APIKey, error)
+}
+
+// APIKeyAuth аутентифицирует запрос по заголовку "Authorization: Bearer <key>"
+// и кладёт в контекст владельца ключа и его права. Запрос без заголовка
+// проходит дальше как есть, с недействительным ключом — получает 401.
+func APIKeyAuth(keys KeyAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, token, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				unauthorized(w, r)
+				return
+			}
+
+			key, err := keys.AuthenticateAPIKey(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				logger.FromContext(r.Context()).Info("Отклонён API-ключ", zap.Error(err))
+				unauthorized(w, r)
+				return
+			}
+
+			ctx := auth.WithUserID(r.Context(), key.UserID)
+			ctx = auth.WithScopes(ctx, key.Scopes)
+			ctx = auth.WithAPIKeyID(ctx, key.ID)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(
+				zap.String("user_id", key.UserID), zap.String("api_key_id", key.ID)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeJSONError(w, r, http.StatusUnauthorized, codeInvalidAPIKey, "Invalid API key", nil)
+}
+
+// RequireScope пропускает только запросы, у которых есть право scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.HasScope(r.Context(), scope) {
+				writeJSONError(w, r, http.StatusForbidden, codeForbidden, "Missing required scope", scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type keyAuthenticatorFunc func(ctx context.Context, token string) (model.APIKey, error)
+
+func (f keyAuthenticatorFunc) AuthenticateAPIKey(ctx context.Context, token string) (model.APIKey, error) {
+	return f(ctx, token)
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := keyAuthenticatorFunc(func(ctx context.Context, token string) (model.APIKey, error) {
+		if token != "sk_k1_good" {
+			return model.APIKey{}, errors.New("invalid API key")
+		}
+		return model.APIKey{ID: "k1", UserID: "owner", Scopes: []string{auth.ScopeLinksRead}}, nil
+	})
+
+	var gotUser, gotKey string
+	var canRead, canWrite bool
+	handler := APIKeyAuth(keys)(Auth(auth.NewSigner("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = auth.UserIDFromContext(r.Context())
+		gotKey = auth.APIKeyIDFromContext(r.Context())
+		canRead = auth.HasScope(r.Context(), auth.ScopeLinksRead)
+		canWrite = auth.HasScope(r.Context(), auth.ScopeLinksWrite)
+	})))
+
+	type testCase struct {
+		name          string
+		authorization string
+		status        int
+		user          string
+		key           string
+		canWrite      bool
+	}
+
+	tests := []testCase{
+		{name: "действительный ключ", authorization: "Bearer sk_k1_good", status: http.StatusOK, user: "owner", key: "k1"},
+		{name: "схема без учёта регистра", authorization: "bearer sk_k1_good", status: http.StatusOK, user: "owner", key: "k1"},
+		{name: "недействительный ключ", authorization: "Bearer sk_k1_bad", status: http.StatusUnauthorized},
+		{name: "другая схема", authorization: "Basic b3duZXI6cGFzcw==", status: http.StatusUnauthorized},
+		{name: "без заголовка — cookie-сессия", status: http.StatusOK, canWrite: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotUser, gotKey, canRead, canWrite = "", "", false, false
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.status, recorder.Code)
+			if test.status != http.StatusOK {
+				assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+				var resp errorResponse
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+				assert.Equal(t, codeInvalidAPIKey, resp.Code)
+				return
+			}
+			if test.user != "" {
+				assert.Equal(t, test.user, gotUser)
+				assert.Empty(t, recorder.Result().Cookies(), "запрос с ключом не получает cookie")
+			} else {
+				assert.NotEmpty(t, gotUser)
+			}
+			assert.Equal(t, test.key, gotKey)
+			assert.True(t, canRead)
+			assert.Equal(t, test.canWrite, canWrite)
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(auth.ScopeLinksWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req.WithContext(auth.WithScopes(req.Context(), []string{auth.ScopeLinksRead})))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var resp errorResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, codeForbidden, resp.Code)
+	assert.Equal(t, auth.ScopeLinksWrite, resp.Details)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req.WithContext(auth.WithScopes(req.Context(), []string{auth.ScopeAdmin})))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	UserCookieName = "user_id"
+	userCookieTTL  = 365 * 24 * time.Hour
+)
+
+// Auth определяет пользователя по подписанной cookie и выдаёт новую, если
+// cookie нет или подпись не сходится. Запросы, уже аутентифицированные
+// API-ключом, пропускаются без изменений. Пользователи из admins получают
+// право auth.ScopeAdmin.
+func Auth(signer *auth.Signer, admins ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.APIKeyIDFromContext(r.Context()) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var userID string
+			if cookie, err := r.Cookie(UserCookieName); err == nil {
+				userID, _ = signer.Verify(cookie.Value)
+			}
+
+			if userID == "" {
+				userID = uuid.New().String()
+				http.SetCookie(w, &http.Cookie{
+					Name:     UserCookieName,
+					Value:    signer.Sign(userID),
+					Path:     "/",
+					MaxAge:   int(userCookieTTL.Seconds()),
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			scopes := auth.SessionScopes
+			if slices.Contains(admins, userID) {
+				scopes = append(slices.Clone(scopes), auth.ScopeAdmin)
+			}
+
+			ctx := auth.WithUserID(r.Context(), userID)
+			ctx = auth.WithScopes(ctx, scopes)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(zap.String("user_id", userID)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
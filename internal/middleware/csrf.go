@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"net/http"
+)
+
+const (
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrf_token"
+
+	csrfMaxFormSize = 1 << 20
+)
+
+type csrfTokenKey struct{}
+
+// CSRFTokenFromContext возвращает токен, который страница должна отправить
+// обратно в поле CSRFFormField или заголовке CSRFHeader.
+func CSRFTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// CSRF проверяет токен у запросов, меняющих состояние. Токен — подпись
+// идентификатора пользователя, поэтому хранить его на сервере не нужно, а
+// чужой токен не подходит. Должен стоять после Auth.
+func CSRF(signer *auth.Signer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			expected := signer.Sign("csrf:" + auth.UserIDFromContext(ctx))
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				token := r.Header.Get(CSRFHeader)
+				if token == "" {
+					r.Body = http.MaxBytesReader(w, r.Body, csrfMaxFormSize)
+					token = r.PostFormValue(CSRFFormField)
+				}
+				if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+					logger.FromContext(ctx).Info("Отклонён запрос с неверным CSRF-токеном")
+					http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+
+			ctx = context.WithValue(ctx, csrfTokenKey{}, expected)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
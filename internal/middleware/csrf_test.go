@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	signer := auth.NewSigner("secret")
+	var token string
+	handler := CSRF(signer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = CSRFTokenFromContext(r.Context())
+	}))
+
+	withUser := func(req *http.Request, userID string) *http.Request {
+		return req.WithContext(auth.WithUserID(req.Context(), userID))
+	}
+	form := func(token string) *http.Request {
+		body := url.Values{CSRFFormField: {token}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/links", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, withUser(httptest.NewRequest(http.MethodGet, "/dashboard", nil), "owner"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	ownerToken := token
+	assert.NotEmpty(t, ownerToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, withUser(httptest.NewRequest(http.MethodGet, "/dashboard", nil), "intruder"))
+	intruderToken := token
+
+	type testCase struct {
+		name   string
+		req    *http.Request
+		status int
+	}
+
+	tests := []testCase{
+		{"form token", form(ownerToken), http.StatusOK},
+		{"no token", form(""), http.StatusForbidden},
+		{"other user's token", form(intruderToken), http.StatusForbidden},
+		{"header token", func() *http.Request {
+			req := httptest.NewRequest(http.MethodDelete, "/api/urls/abc", nil)
+			req.Header.Set(CSRFHeader, ownerToken)
+			return req
+		}(), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, withUser(tt.req, "owner"))
+			assert.Equal(t, tt.status, recorder.Code)
+		})
+	}
+}
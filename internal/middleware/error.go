@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Коды совпадают с кодами пакета handler: клиенты API получают один формат
+// ошибок независимо от того, где запрос был отклонён.
+const (
+	codeForbidden     = "forbidden"
+	codeInvalidAPIKey = "invalid_api_key"
+)
+
+// errorResponse повторяет handler.ErrorResponse. Пакет handler сам зависит
+// от middleware, поэтому тип не переиспользуется.
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		id = r.Header.Get(RequestIDHeader)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: id,
+	})
+}
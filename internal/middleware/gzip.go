@@ -2,20 +2,255 @@ package middleware
 
 import (
 	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+const (
+	encodingZstd     = "zstd"
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
+
+// Порядок определяет предпочтение сервера при одинаковых q-значениях.
+var supportedEncodings = []string{encodingZstd, encodingBrotli, encodingGzip, encodingDeflate}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type decoder interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+func (z zstdEncoder) Reset(w io.Writer) {
+	z.Encoder.Reset(w)
+}
+
+type zlibDecoder struct {
+	io.ReadCloser
+}
+
+func (z zlibDecoder) Reset(r io.Reader) error {
+	return z.ReadCloser.(zlib.Resetter).Reset(r, nil)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingZstd: {New: func() any {
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return zstdEncoder{zw}
+	}},
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	encodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	encodingDeflate: {New: func() any {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+var decoderPools = map[string]*sync.Pool{
+	encodingZstd:    {},
+	encodingBrotli:  {},
+	encodingGzip:    {},
+	encodingDeflate: {},
+}
+
+func newDecoder(encoding string, r io.Reader) (decoder, error) {
+	if d, ok := decoderPools[encoding].Get().(decoder); ok {
+		if err := d.Reset(r); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	switch encoding {
+	case encodingZstd:
+		return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	case encodingBrotli:
+		return brotli.NewReader(r), nil
+	case encodingGzip:
+		return gzip.NewReader(r)
+	case encodingDeflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zlibDecoder{zr}, nil
+	}
+	return nil, errUnsupportedEncoding
+}
+
+type acceptedEncoding struct {
+	name string
+	q    float64
+}
+
+func parseAcceptEncoding(header string) []acceptedEncoding {
+	var result []acceptedEncoding
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			} else {
+				q = 0
+			}
+		}
+
+		result = append(result, acceptedEncoding{name: name, q: q})
+	}
+	return result
+}
+
+// negotiateEncoding возвращает кодировку ответа или пустую строку, если
+// ответ нужно отдать без сжатия.
+func negotiateEncoding(header string) string {
+	accepted := parseAcceptEncoding(header)
+	if len(accepted) == 0 {
+		return ""
+	}
+
+	wildcard := -1.0
+	explicit := make(map[string]float64, len(accepted))
+	for _, a := range accepted {
+		if a.name == "*" {
+			wildcard = a.q
+			continue
+		}
+		explicit[a.name] = a.q
+	}
+
+	type candidate struct {
+		name  string
+		q     float64
+		order int
+	}
+	var candidates []candidate
+	for i, name := range supportedEncodings {
+		q, ok := explicit[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{name: name, q: q, order: i})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].order < candidates[j].order
+	})
+
+	best := candidates[0]
+	if identityQ, ok := explicit[encodingIdentity]; ok && identityQ > best.q {
+		return ""
+	}
+	return best.name
+}
+
+type CompressionConfig struct {
+	MinSize int
+
+	MaxCompressedSize   int64
+	MaxDecompressedSize int64
+	MaxRatio            float64
+}
+
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		MinSize:             256,
+		MaxCompressedSize:   1 << 20,
+		MaxDecompressedSize: 8 << 20,
+		MaxRatio:            100,
+	}
+}
+
+// Ниже этого объёма распакованных данных коэффициент сжатия не проверяется:
+// короткие повторяющиеся тела легально сжимаются очень сильно.
+const ratioCheckFloor = 64 << 10
+
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressWriter копит первые байты ответа и только потом решает, сжимать
+// ли его: по статусу, типу содержимого и размеру тела.
 type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w        http.ResponseWriter
+	zw       encoder
+	encoding string
+	minSize  int
+
+	buf     []byte
+	status  int
+	decided bool
 }
 
-func newCompressWriter(w http.ResponseWriter) *compressWriter {
+func newCompressWriter(w http.ResponseWriter, encoding string, minSize int) *compressWriter {
 	return &compressWriter{
-		w:  w,
-		zw: gzip.NewWriter(w),
+		w:        w,
+		encoding: encoding,
+		minSize:  minSize,
 	}
 }
 
@@ -23,77 +258,256 @@ func (c *compressWriter) Header() http.Header {
 	return c.w.Header()
 }
 
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+func (c *compressWriter) shouldCompress() bool {
+	header := c.w.Header()
+	if !bodyAllowed(c.status) || header.Get("Content-Encoding") != "" || len(c.buf) == 0 {
+		return false
+	}
+	if len(c.buf) < c.minSize {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(c.buf)
+		header.Set("Content-Type", contentType)
+	}
+	return compressibleType(contentType)
+}
+
+func (c *compressWriter) decide() error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	if c.shouldCompress() {
+		header := c.w.Header()
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+
+		c.zw = encoderPools[c.encoding].Get().(encoder)
+		c.zw.Reset(c.w)
+	}
+
+	c.w.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.zw != nil {
+		_, err := c.zw.Write(buf)
+		return err
+	}
+	_, err := c.w.Write(buf)
+	return err
+}
+
 func (c *compressWriter) Write(p []byte) (int, error) {
-	return c.zw.Write(p)
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	if !c.decided {
+		if !bodyAllowed(c.status) {
+			if err := c.decide(); err != nil {
+				return 0, err
+			}
+			return c.w.Write(p)
+		}
+
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < c.minSize {
+			return len(p), nil
+		}
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if c.zw != nil {
+		return c.zw.Write(p)
+	}
+	return c.w.Write(p)
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
-	contentType := c.w.Header().Get("Content-Type")
-	if strings.Contains(contentType, "application/json") ||
-		strings.Contains(contentType, "text/html") ||
-		strings.Contains(contentType, "text/plain") {
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if c.status != 0 {
+		return
 	}
 
-	c.w.WriteHeader(statusCode)
+	if statusCode < http.StatusOK {
+		c.w.WriteHeader(statusCode)
+		return
+	}
+
+	c.status = statusCode
+	if !bodyAllowed(statusCode) {
+		c.decide()
+	}
+}
+
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		c.decide()
+	}
+	if c.zw != nil {
+		c.zw.Flush()
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 func (c *compressWriter) Close() error {
-	return c.zw.Close()
+	var err error
+	if !c.decided {
+		err = c.decide()
+	}
+
+	if c.zw != nil {
+		if closeErr := c.zw.Close(); err == nil {
+			err = closeErr
+		}
+		c.zw.Reset(io.Discard)
+		encoderPools[c.encoding].Put(c.zw)
+		c.zw = nil
+	}
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 type compressReader struct {
-	r  io.ReadCloser
-	zr *gzip.Reader
+	r        io.ReadCloser
+	zr       decoder
+	encoding string
+
+	compressed   *countingReader
+	decompressed int64
+	maxSize      int64
+	maxRatio     float64
 }
 
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	zr, err := gzip.NewReader(r)
+func newCompressReader(r io.ReadCloser, encoding string, cfg CompressionConfig) (*compressReader, error) {
+	if _, ok := decoderPools[encoding]; !ok {
+		return nil, errUnsupportedEncoding
+	}
+
+	compressed := &countingReader{r: r}
+	zr, err := newDecoder(encoding, compressed)
 	if err != nil {
 		return nil, err
 	}
 
 	return &compressReader{
-		r:  r,
-		zr: zr,
+		r:          r,
+		zr:         zr,
+		encoding:   encoding,
+		compressed: compressed,
+		maxSize:    cfg.MaxDecompressedSize,
+		maxRatio:   cfg.MaxRatio,
 	}, nil
 }
 
-func (c compressReader) Read(p []byte) (n int, err error) {
-	return c.zr.Read(p)
+// Read возвращает *http.MaxBytesError при превышении лимитов, чтобы
+// хэндлеры обрабатывали распакованное тело так же, как слишком большое обычное.
+func (c *compressReader) Read(p []byte) (n int, err error) {
+	if c.zr == nil {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	n, err = c.zr.Read(p)
+	c.decompressed += int64(n)
+
+	if c.maxSize > 0 && c.decompressed > c.maxSize {
+		return n, &http.MaxBytesError{Limit: c.maxSize}
+	}
+	if c.maxRatio > 0 && c.decompressed > ratioCheckFloor &&
+		float64(c.decompressed) > c.maxRatio*float64(c.compressed.n) {
+		return n, &http.MaxBytesError{Limit: int64(c.maxRatio * float64(c.compressed.n))}
+	}
+	return n, err
 }
 
+// Close можно вызывать повторно: тело закрывают и хэндлер, и middleware.
+// Декодер возвращается в пул только при первом вызове, иначе два запроса
+// получили бы из пула один и тот же декодер.
 func (c *compressReader) Close() error {
-	if err := c.r.Close(); err != nil {
-		return err
+	if c.zr == nil {
+		return nil
 	}
-	return c.zr.Close()
+	decoderPools[c.encoding].Put(c.zr)
+	c.zr = nil
+	return c.r.Close()
 }
 
 func GzipMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ow := w
+	return NewGzipMiddleware(DefaultCompressionConfig())(next)
+}
 
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportsGzip := strings.Contains(acceptEncoding, "gzip")
-		if supportsGzip {
-			cw := newCompressWriter(w)
-			ow = cw
-			defer cw.Close()
-		}
+func NewGzipMiddleware(cfg CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveCompressed(cfg, next, w, r)
+		})
+	}
+}
 
-		contentEncoding := r.Header.Get("Content-Encoding")
-		sendsGzip := strings.Contains(contentEncoding, "gzip")
-		if sendsGzip {
-			cr, err := newCompressReader(r.Body)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+func serveCompressed(cfg CompressionConfig, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	ow := w
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if contentEncoding != "" && contentEncoding != encodingIdentity {
+		if cfg.MaxCompressedSize > 0 {
+			if r.ContentLength > cfg.MaxCompressedSize {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 				return
 			}
-			r.Body = cr
-			defer cr.Close()
+			r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxCompressedSize)
 		}
 
-		next.ServeHTTP(ow, r)
-	})
+		cr, err := newCompressReader(r.Body, contentEncoding, cfg)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errUnsupportedEncoding):
+			http.Error(w, "Unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		case errors.As(err, &maxBytesErr):
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, "Invalid compressed request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = cr
+		r.Header.Del("Content-Encoding")
+		defer cr.Close()
+	}
+
+	if r.Method != http.MethodHead {
+		if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding")); encoding != "" {
+			cw := newCompressWriter(w, encoding, cfg.MinSize)
+			ow = cw
+			defer cw.Close()
+		}
+	}
+
+	next.ServeHTTP(ow, r)
 }
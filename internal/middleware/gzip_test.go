@@ -3,14 +3,72 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 )
 
+func compressBody(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "deflate":
+		zw = zlib.NewWriter(&buf)
+	case "br":
+		zw = brotli.NewWriter(&buf)
+	case "zstd":
+		enc, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		zw = enc
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func decompressBody(t *testing.T, encoding string, r io.Reader) []byte {
+	var zr io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		zr = gz
+	case "deflate":
+		zl, err := zlib.NewReader(r)
+		require.NoError(t, err)
+		zr = zl
+	case "br":
+		zr = brotli.NewReader(r)
+	case "zstd":
+		dec, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer dec.Close()
+		zr = dec
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return data
+}
+
 func TestGzipMiddleware(t *testing.T) {
 	dummyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
@@ -22,7 +80,7 @@ func TestGzipMiddleware(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	handlerToTest := GzipMiddleware(dummyHandler)
+	handlerToTest := NewGzipMiddleware(CompressionConfig{MinSize: 1})(dummyHandler)
 	srv := httptest.NewServer(handlerToTest)
 	defer srv.Close()
 
@@ -30,9 +88,11 @@ func TestGzipMiddleware(t *testing.T) {
 		name                     string
 		requestBody              string
 		compressRequest          bool
+		requestEncoding          string
 		headers                  map[string]string
 		expectedStatusCode       int
 		expectCompressedResponse bool
+		expectedEncoding         string
 		expectedResponseBody     string
 	}
 
@@ -66,25 +126,87 @@ func TestGzipMiddleware(t *testing.T) {
 			expectCompressedResponse: false,
 			expectedResponseBody:     requestBody,
 		},
+		{
+			name:                     "client prefers encoding by q-value",
+			requestBody:              requestBody,
+			headers:                  map[string]string{"Accept-Encoding": "gzip;q=0.5, br;q=0.8, deflate;q=0.1", "Content-Type": "application/json"},
+			expectedStatusCode:       http.StatusOK,
+			expectCompressedResponse: true,
+			expectedEncoding:         "br",
+			expectedResponseBody:     requestBody,
+		},
+		{
+			name:                     "client refuses gzip with q=0",
+			requestBody:              requestBody,
+			headers:                  map[string]string{"Accept-Encoding": "gzip;q=0", "Content-Type": "application/json"},
+			expectedStatusCode:       http.StatusOK,
+			expectCompressedResponse: false,
+			expectedResponseBody:     requestBody,
+		},
+		{
+			name:                     "wildcard picks server preference",
+			requestBody:              requestBody,
+			headers:                  map[string]string{"Accept-Encoding": "*", "Content-Type": "application/json"},
+			expectedStatusCode:       http.StatusOK,
+			expectCompressedResponse: true,
+			expectedEncoding:         "zstd",
+			expectedResponseBody:     requestBody,
+		},
+		{
+			name:                     "identity preferred over gzip",
+			requestBody:              requestBody,
+			headers:                  map[string]string{"Accept-Encoding": "gzip;q=0.2, identity", "Content-Type": "application/json"},
+			expectedStatusCode:       http.StatusOK,
+			expectCompressedResponse: false,
+			expectedResponseBody:     requestBody,
+		},
+		{
+			name:               "unsupported request encoding",
+			requestBody:        requestBody,
+			headers:            map[string]string{"Content-Encoding": "compress", "Content-Type": "application/json"},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, encoding := range []string{"br", "zstd", "deflate"} {
+		tests = append(tests,
+			testCase{
+				name:                 "client sends " + encoding + " data",
+				requestBody:          requestBody,
+				compressRequest:      true,
+				requestEncoding:      encoding,
+				headers:              map[string]string{"Content-Encoding": encoding, "Content-Type": "application/json"},
+				expectedStatusCode:   http.StatusOK,
+				expectedResponseBody: requestBody,
+			},
+			testCase{
+				name:                     "client accepts " + encoding + " data",
+				requestBody:              requestBody,
+				headers:                  map[string]string{"Accept-Encoding": encoding, "Content-Type": "application/json"},
+				expectedStatusCode:       http.StatusOK,
+				expectCompressedResponse: true,
+				expectedEncoding:         encoding,
+				expectedResponseBody:     requestBody,
+			},
+		)
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			var body io.Reader
 			if test.compressRequest {
-				var buf bytes.Buffer
-				gz := gzip.NewWriter(&buf)
-				_, err := gz.Write([]byte(test.requestBody))
-				require.NoError(t, err)
-				err = gz.Close()
-				require.NoError(t, err)
-				body = &buf
+				encoding := test.requestEncoding
+				if encoding == "" {
+					encoding = "gzip"
+				}
+				body = bytes.NewReader(compressBody(t, encoding, []byte(test.requestBody)))
 			} else {
 				body = bytes.NewBufferString(test.requestBody)
 			}
 
 			req, err := http.NewRequest(http.MethodPost, srv.URL, body)
 			require.NoError(t, err)
+			req.Header.Set("Accept-Encoding", "identity")
 
 			for key, value := range test.headers {
 				req.Header.Set(key, value)
@@ -95,15 +217,19 @@ func TestGzipMiddleware(t *testing.T) {
 			defer resp.Body.Close()
 
 			assert.Equal(t, test.expectedStatusCode, resp.StatusCode)
+			assert.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+			if test.expectedStatusCode != http.StatusOK {
+				return
+			}
 
 			var respBody []byte
 			if test.expectCompressedResponse {
-				assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
-
-				gz, err := gzip.NewReader(resp.Body)
-				require.NoError(t, err)
-				respBody, err = io.ReadAll(gz)
-				require.NoError(t, err)
+				encoding := test.expectedEncoding
+				if encoding == "" {
+					encoding = "gzip"
+				}
+				assert.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+				respBody = decompressBody(t, encoding, resp.Body)
 			} else {
 				assert.Empty(t, resp.Header.Get("Content-Encoding"))
 				respBody, err = io.ReadAll(resp.Body)
@@ -114,3 +240,247 @@ func TestGzipMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressWriter(t *testing.T) {
+	largeBody := strings.Repeat(`{"url": "https://practicum.yandex.ru"}`, 20)
+
+	type testCase struct {
+		name             string
+		method           string
+		handler          http.HandlerFunc
+		expectedStatus   int
+		expectedEncoding string
+		expectedBody     string
+	}
+
+	tests := []testCase{
+		{
+			name:   "redirect without body",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", "https://practicum.yandex.ru")
+				w.WriteHeader(http.StatusTemporaryRedirect)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedEncoding: "",
+			expectedBody:     "",
+		},
+		{
+			name:   "body below threshold",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("short"))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedEncoding: "",
+			expectedBody:     "short",
+		},
+		{
+			name:   "large body without WriteHeader",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Length", strconv.Itoa(len(largeBody)))
+				w.Write([]byte(largeBody))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedEncoding: "gzip",
+			expectedBody:     largeBody,
+		},
+		{
+			name:   "large body in small chunks",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusCreated)
+				for _, ch := range largeBody {
+					w.Write([]byte(string(ch)))
+				}
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedEncoding: "gzip",
+			expectedBody:     largeBody,
+		},
+		{
+			name:   "incompressible content type",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(largeBody))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedEncoding: "",
+			expectedBody:     largeBody,
+		},
+		{
+			name:   "no content",
+			method: http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expectedStatus:   http.StatusNoContent,
+			expectedEncoding: "",
+			expectedBody:     "",
+		},
+		{
+			name:   "HEAD request",
+			method: http.MethodHead,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedEncoding: "",
+			expectedBody:     "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := NewGzipMiddleware(CompressionConfig{MinSize: 256})(test.handler)
+
+			req := httptest.NewRequest(test.method, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, test.expectedStatus, res.StatusCode)
+			assert.Equal(t, test.expectedEncoding, res.Header.Get("Content-Encoding"))
+
+			var body []byte
+			if test.expectedEncoding != "" {
+				assert.Empty(t, res.Header.Get("Content-Length"))
+				body = decompressBody(t, test.expectedEncoding, res.Body)
+			} else {
+				var err error
+				body, err = io.ReadAll(res.Body)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedBody, string(body))
+		})
+	}
+}
+
+func TestCompressWriterFlush(t *testing.T) {
+	handler := NewGzipMiddleware(CompressionConfig{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("first chunk"))
+
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+		flusher.Flush()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, req)
+
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "first chunk", recorder.Body.String())
+}
+
+func TestGzipMiddlewareLimits(t *testing.T) {
+	readingHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CompressionConfig{
+		MaxCompressedSize:   4 << 10,
+		MaxDecompressedSize: 1 << 20,
+		MaxRatio:            50,
+	}
+	handler := NewGzipMiddleware(cfg)(readingHandler)
+
+	type testCase struct {
+		name           string
+		body           []byte
+		expectedStatus int
+	}
+
+	tests := []testCase{
+		{
+			name:           "valid compressed body",
+			body:           compressBody(t, "gzip", []byte(`{"url": "https://practicum.yandex.ru"}`)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid gzip body",
+			body:           []byte("definitely not gzip"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "compressed body too large",
+			body:           compressBody(t, "gzip", randomBytes(t, 8<<10)),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "decompression bomb",
+			body:           compressBody(t, "gzip", make([]byte, 2<<20)),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "compression ratio exceeded",
+			body:           compressBody(t, "gzip", make([]byte, 512<<10)),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			req.Header.Set("Content-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestCompressReaderCloseTwice(t *testing.T) {
+	for _, encoding := range []string{encodingGzip, encodingDeflate, encodingBrotli, encodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				w.Write(body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressBody(t, encoding, []byte("payload"))))
+			req.Header.Set("Content-Encoding", encoding)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, "payload", recorder.Body.String())
+
+			first := decoderPools[encoding].Get()
+			second := decoderPools[encoding].Get()
+			if first != nil && second != nil {
+				assert.False(t, first == second, "декодер вернулся в пул дважды")
+			}
+		})
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	return data
+}
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/metrics"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -28,6 +31,16 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.data.status = statusCode
 }
 
+func (r *loggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -42,12 +55,35 @@ func RequestLogger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(&lw, r)
 
-		logger.Log.Info("Request processed",
+		duration := time.Since(start)
+		if rd.status == 0 {
+			rd.status = http.StatusOK
+		}
+
+		status := strconv.Itoa(rd.status)
+		route := routePattern(r)
+		metrics.HTTPRequestsTotal.WithLabelValues(route, r.Method, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method, status).Observe(duration.Seconds())
+
+		logger.FromContext(r.Context()).Info("Request processed",
 			zap.String("uri", r.RequestURI),
 			zap.String("method", r.Method),
-			zap.Duration("duration", time.Since(start)),
+			zap.Duration("duration", duration),
 			zap.Int("status_code", rd.status),
 			zap.Int("response_size", rd.size),
 		)
 	})
 }
+
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+
+	pattern := rctx.RoutePattern()
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
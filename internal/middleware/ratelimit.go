@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"container/list"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRateLimitEntries = 100000
+
+type KeyFunc func(r *http.Request) string
+
+type ClientIPResolver struct {
+	trustedProxies []*net.IPNet
+}
+
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	for _, cidr := range trustedProxies {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, subnet)
+	}
+	return resolver, nil
+}
+
+func (c *ClientIPResolver) trusted(ip net.IP) bool {
+	if c == nil {
+		return false
+	}
+	for _, subnet := range c.trustedProxies {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromProxy сообщает, пришёл ли запрос напрямую от доверенного прокси.
+func (c *ClientIPResolver) fromProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && c.trusted(ip)
+}
+
+func (c *ClientIPResolver) Resolve(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !c.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// ClientKey ограничивает запросы по API-ключу, которым они аутентифицированы,
+// а остальные — по адресу клиента. Сырой заголовок Authorization не
+// учитывается: иначе случайный токен в каждом запросе давал бы новый лимит.
+// Идентификатор пользователя из cookie тоже не подходит — Auth выдаёт новый
+// любому клиенту без cookie. Лимитер должен стоять после APIKeyAuth.
+func ClientKey(resolver *ClientIPResolver) KeyFunc {
+	return func(r *http.Request) string {
+		if keyID := auth.APIKeyIDFromContext(r.Context()); keyID != "" {
+			return "key:" + keyID
+		}
+		return "ip:" + resolver.Resolve(r)
+	}
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+type RateLimiter struct {
+	rate       float64
+	burst      int
+	maxEntries int
+	keyFunc    KeyFunc
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	buckets map[string]*list.Element
+}
+
+func NewRateLimiter(rate float64, burst, maxEntries int, keyFunc KeyFunc) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if maxEntries < 1 {
+		maxEntries = defaultRateLimitEntries
+	}
+
+	return &RateLimiter{
+		rate:       rate,
+		burst:      burst,
+		maxEntries: maxEntries,
+		keyFunc:    keyFunc,
+		now:        time.Now,
+		order:      list.New(),
+		buckets:    make(map[string]*list.Element),
+	}
+}
+
+func (l *RateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration((float64(l.burst) - tokens) / l.rate * float64(time.Second))
+}
+
+func (l *RateLimiter) evict(now time.Time) {
+	for e := l.order.Back(); e != nil; e = l.order.Back() {
+		b := e.Value.(*bucket)
+		if len(l.buckets) < l.maxEntries && now.Sub(b.last) < l.refillTime(b.tokens) {
+			return
+		}
+		l.order.Remove(e)
+		delete(l.buckets, b.key)
+	}
+}
+
+func (l *RateLimiter) Allow(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	var b *bucket
+	if e, ok := l.buckets[key]; ok {
+		b = e.Value.(*bucket)
+		b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+		l.order.MoveToFront(e)
+	} else {
+		l.evict(now)
+		b = &bucket{key: key, tokens: float64(l.burst), last: now}
+		l.buckets[key] = l.order.PushFront(b)
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+
+	b.tokens--
+	return true, int(b.tokens), l.refillTime(b.tokens)
+}
+
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l == nil || l.rate <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, wait := l.Allow(l.keyFunc(r))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(l.burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", ceilSeconds(wait))
+
+		if !allowed {
+			w.Header().Set("Retry-After", ceilSeconds(wait))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
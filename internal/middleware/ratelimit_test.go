@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	resolver, err := NewClientIPResolver(nil)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 2, 10, ClientKey(resolver))
+	limiter.now = func() time.Time { return now }
+
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	do := func(remoteAddr string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	res := do("1.1.1.1:1000")
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+
+	res = do("1.1.1.1:1000")
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+
+	res = do("1.1.1.1:1000")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	res = do("2.2.2.2:1000")
+	assert.Equal(t, http.StatusCreated, res.StatusCode, "другой клиент не должен быть ограничен")
+
+	now = now.Add(time.Second)
+	res = do("1.1.1.1:1000")
+	assert.Equal(t, http.StatusCreated, res.StatusCode, "токен должен восстановиться")
+}
+
+func TestRateLimiterBoundedMemory(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 5, 3, nil)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		limiter.Allow(fmt.Sprintf("client-%d", i))
+	}
+	assert.Equal(t, 3, limiter.Len())
+
+	now = now.Add(time.Minute)
+	limiter.Allow("fresh")
+	assert.Equal(t, 1, limiter.Len(), "восстановившиеся записи должны удаляться")
+}
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	type testCase struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expected     string
+	}
+
+	tests := []testCase{
+		{
+			name:       "прямое подключение",
+			remoteAddr: "203.0.113.5:1000",
+			expected:   "203.0.113.5",
+		},
+		{
+			name:         "недоверенный клиент подделывает X-Forwarded-For",
+			remoteAddr:   "203.0.113.5:1000",
+			forwardedFor: "198.51.100.1",
+			expected:     "203.0.113.5",
+		},
+		{
+			name:         "запрос через доверенные прокси",
+			remoteAddr:   "10.0.0.1:1000",
+			forwardedFor: "198.51.100.1, 203.0.113.7, 10.0.0.2",
+			expected:     "203.0.113.7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			assert.Equal(t, test.expected, resolver.Resolve(req))
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	resolver, err := NewClientIPResolver(nil)
+	require.NoError(t, err)
+	key := ClientKey(resolver)
+
+	type testCase struct {
+		name          string
+		authorization string
+		apiKeyID      string
+		expected      string
+	}
+
+	tests := []testCase{
+		{
+			name:     "без ключа",
+			expected: "ip:203.0.113.5",
+		},
+		{
+			name:          "непроверенный Bearer-токен не меняет ключ",
+			authorization: "Bearer random-token",
+			expected:      "ip:203.0.113.5",
+		},
+		{
+			name:          "аутентифицированный API-ключ",
+			authorization: "Bearer sk_k1_secret",
+			apiKeyID:      "k1",
+			expected:      "key:k1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "203.0.113.5:1000"
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			if test.apiKeyID != "" {
+				req = req.WithContext(auth.WithAPIKeyID(req.Context(), test.apiKeyID))
+			}
+			assert.Equal(t, test.expected, key(req))
+		})
+	}
+}
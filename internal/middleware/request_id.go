@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(zap.String("request_id", id)))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	type testCase struct {
+		name       string
+		incomingID string
+		expectSame bool
+	}
+
+	tests := []testCase{
+		{
+			name:       "ID передан клиентом",
+			incomingID: "client-id-123",
+			expectSame: true,
+		},
+		{
+			name:       "ID не передан",
+			incomingID: "",
+			expectSame: false,
+		},
+		{
+			name:       "ID слишком длинный",
+			incomingID: strings.Repeat("a", maxRequestIDLength+1),
+			expectSame: false,
+		},
+		{
+			name:       "ID с недопустимыми символами",
+			incomingID: "bad id\n",
+			expectSame: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			prevLog := logger.Log
+			logger.Log = zap.New(core)
+			defer func() { logger.Log = prevLog }()
+
+			var ctxID string
+			handler := RequestID(RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = RequestIDFromContext(r.Context())
+				logger.FromContext(r.Context()).Info("inside handler")
+				w.WriteHeader(http.StatusNoContent)
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.incomingID != "" {
+				req.Header.Set(RequestIDHeader, test.incomingID)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			respID := recorder.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, respID)
+			assert.Equal(t, respID, ctxID)
+			if test.expectSame {
+				assert.Equal(t, test.incomingID, respID)
+			} else {
+				assert.NotEqual(t, test.incomingID, respID)
+			}
+
+			entries := logs.All()
+			require.Len(t, entries, 2)
+			for _, entry := range entries {
+				assert.Equal(t, respID, entry.ContextMap()["request_id"])
+			}
+		})
+	}
+}
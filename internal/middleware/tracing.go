@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const tracerName = "github.com/Guram-Gurych/shortenerURL.git/internal/middleware"
+
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		if id := RequestIDFromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		rd := &responseData{
+			status: 0,
+			size:   0,
+		}
+		lw := loggingResponseWriter{
+			ResponseWriter: w,
+			data:           rd,
+		}
+
+		next.ServeHTTP(&lw, r.WithContext(ctx))
+
+		if rd.status == 0 {
+			rd.status = http.StatusOK
+		}
+
+		route := routePattern(r)
+		span.SetName(fmt.Sprintf("%s %s", r.Method, route))
+		span.SetAttributes(
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", rd.status),
+		)
+		if rd.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rd.status))
+		}
+	})
+}
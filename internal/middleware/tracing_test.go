@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	router := chi.NewRouter()
+	router.Use(Tracing)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "child")
+		span.End()
+
+		if chi.URLParam(r, "id") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	t.Run("propagates traceparent", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+
+		child, server := spans[0], spans[1]
+		assert.Equal(t, "GET /{id}", server.Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+		assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusTemporaryRedirect))
+		assert.Contains(t, server.Attributes(), attribute.String("http.route", "/{id}"))
+	})
+
+	t.Run("marks server errors", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/broken", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		server := spans[len(spans)-1]
+		assert.Equal(t, codes.Error, server.Status().Code)
+		assert.False(t, server.Parent().IsValid())
+	})
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP возвращает адрес клиента. X-Real-IP учитывается, только если
+// запрос пришёл от доверенного прокси: иначе заголовок может подставить кто
+// угодно. Без resolver заголовкам не доверяется вовсе.
+func clientIP(resolver *ClientIPResolver, r *http.Request) net.IP {
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" && resolver.fromProxy(r) {
+		return net.ParseIP(realIP)
+	}
+	return net.ParseIP(resolver.Resolve(r))
+}
+
+func parseSubnet(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	return subnet, err
+}
+
+func fromSubnet(subnet *net.IPNet, resolver *ClientIPResolver, r *http.Request) bool {
+	ip := clientIP(resolver, r)
+	return subnet != nil && ip != nil && subnet.Contains(ip)
+}
+
+// TrustedSubnet пропускает только запросы из подсети cidr. Адрес клиента
+// определяется через resolver с учётом доверенных прокси.
+func TrustedSubnet(cidr string, resolver *ClientIPResolver) (func(http.Handler) http.Handler, error) {
+	subnet, err := parseSubnet(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fromSubnet(subnet, resolver, r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// TrustedSubnetOrAdminKey пропускает запросы из доверенной подсети, а также
+// запросы с API-ключом, у которого есть право admin. Должен стоять после
+// APIKeyAuth. Адрес клиента определяется через resolver, как в TrustedSubnet.
+func TrustedSubnetOrAdminKey(cidr string, resolver *ClientIPResolver) (func(http.Handler) http.Handler, error) {
+	subnet, err := parseSubnet(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			adminKey := auth.APIKeyIDFromContext(ctx) != "" && auth.HasScope(ctx, auth.ScopeAdmin)
+			if !adminKey && !fromSubnet(subnet, resolver, r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedSubnet(t *testing.T) {
+	type testCase struct {
+		name           string
+		subnet         string
+		remoteAddr     string
+		realIP         string
+		proxies        []string
+		expectedStatus int
+	}
+
+	tests := []testCase{
+		{
+			name:           "адрес из доверенной подсети",
+			subnet:         "10.0.0.0/8",
+			remoteAddr:     "10.1.2.3:5555",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "X-Real-IP от доверенного прокси",
+			subnet:         "10.0.0.0/8",
+			remoteAddr:     "192.168.1.1:5555",
+			realIP:         "10.1.2.3",
+			proxies:        []string{"192.168.1.0/24"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "X-Real-IP от недоверенного клиента",
+			subnet:         "10.0.0.0/8",
+			remoteAddr:     "203.0.113.7:5555",
+			realIP:         "10.1.2.3",
+			proxies:        []string{"192.168.1.0/24"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "X-Forwarded-For от доверенного прокси",
+			subnet:         "10.0.0.0/8",
+			remoteAddr:     "192.168.1.1:5555",
+			proxies:        []string{"192.168.1.0/24"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "адрес вне подсети",
+			subnet:         "10.0.0.0/8",
+			remoteAddr:     "192.168.1.1:5555",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "подсеть не задана",
+			subnet:         "",
+			remoteAddr:     "10.1.2.3:5555",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolver, err := NewClientIPResolver(test.proxies)
+			require.NoError(t, err)
+			trusted, err := TrustedSubnet(test.subnet, resolver)
+			require.NoError(t, err)
+
+			handler := trusted(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.realIP != "" {
+				req.Header.Set("X-Real-IP", test.realIP)
+			} else if test.proxies != nil {
+				req.Header.Set("X-Forwarded-For", "10.1.2.3")
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.expectedStatus, recorder.Code)
+		})
+	}
+
+	_, err := TrustedSubnet("not-a-cidr", nil)
+	assert.Error(t, err)
+}
+
+func TestTrustedSubnetOrAdminKey(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"192.168.1.0/24"})
+	require.NoError(t, err)
+	internal, err := TrustedSubnetOrAdminKey("10.0.0.0/8", resolver)
+	require.NoError(t, err)
+	handler := internal(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr, realIP, keyID string, scopes ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+		req.RemoteAddr = remoteAddr
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		ctx := auth.WithScopes(req.Context(), scopes)
+		if keyID != "" {
+			ctx = auth.WithAPIKeyID(ctx, keyID)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req.WithContext(ctx))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("10.1.2.3:5555", "", ""))
+	assert.Equal(t, http.StatusOK, request("192.168.1.1:5555", "10.1.2.3", ""), "X-Real-IP от доверенного прокси")
+	assert.Equal(t, http.StatusForbidden, request("203.0.113.7:5555", "10.1.2.3", ""), "подделанный X-Real-IP")
+	assert.Equal(t, http.StatusOK, request("203.0.113.7:5555", "", "k1", auth.ScopeAdmin))
+	assert.Equal(t, http.StatusForbidden, request("203.0.113.7:5555", "", "k1", auth.ScopeLinksRead))
+	assert.Equal(t, http.StatusForbidden, request("203.0.113.7:5555", "", "", auth.ScopeAdmin), "admin-сессия по cookie не в счёт")
+}
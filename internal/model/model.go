@@ -1,7 +1,187 @@
 package model
 
+import "time"
+
+// Причины отключения ссылки.
+const (
+	DisabledByBlocklist = "blocklist"
+	DisabledByAdmin     = "admin"
+)
+
+// Способы перенаправления. Пустой RedirectType у ссылки означает способ по
+// умолчанию из конфигурации сервера.
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+	RedirectMetaRefresh      = "meta"
+	RedirectJavaScript       = "js"
+)
+
+func ValidRedirectType(redirectType string) bool {
+	switch redirectType {
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent,
+		RedirectMetaRefresh, RedirectJavaScript:
+		return true
+	}
+	return false
+}
+
+// Политики слияния параметров запроса с уже имеющимися в адресе назначения.
+// Пустая QueryConflict у ссылки означает QueryKeep.
+const (
+	QueryKeep     = "keep"
+	QueryOverride = "override"
+	QueryAppend   = "append"
+)
+
+func ValidQueryConflict(policy string) bool {
+	switch policy {
+	case QueryKeep, QueryOverride, QueryAppend:
+		return true
+	}
+	return false
+}
+
+// Состояния ссылки относительно окна активности и сроков действия.
+const (
+	StateScheduled = "scheduled"
+	StateActive    = "active"
+	StateExpired   = "expired"
+	StateDeleted   = "deleted"
+)
+
+func ValidState(state string) bool {
+	switch state {
+	case StateScheduled, StateActive, StateExpired, StateDeleted:
+		return true
+	}
+	return false
+}
+
 type URLModel struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UUID           string            `json:"uuid"`
+	ShortURL       string            `json:"short_url"`
+	OriginalURL    string            `json:"original_url"`
+	UserID         string            `json:"user_id,omitempty"`
+	Version        int64             `json:"version,omitempty"`
+	CreatedAt      time.Time         `json:"created_at,omitzero"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Disabled       bool              `json:"disabled,omitempty"`
+	DisabledReason string            `json:"disabled_reason,omitempty"`
+	PasswordHash   string            `json:"password_hash,omitempty"`
+	Clicks         int64             `json:"clicks,omitempty"`
+	MaxClicks      int64             `json:"max_clicks,omitempty"`
+	Interstitial   bool              `json:"interstitial,omitempty"`
+	RedirectType   string            `json:"redirect_type,omitempty"`
+	Rules          []Rule            `json:"rules,omitempty"`
+	Variants       []Variant         `json:"variants,omitempty"`
+	QueryParams    map[string]string `json:"query_params,omitempty"`
+	QueryConflict  string            `json:"query_conflict,omitempty"`
+	ForwardQuery   bool              `json:"forward_query,omitempty"`
+	ActiveFrom     *time.Time        `json:"active_from,omitempty"`
+	ActiveUntil    *time.Time        `json:"active_until,omitempty"`
+	FallbackURL    string            `json:"fallback_url,omitempty"`
+	DeletedAt      *time.Time        `json:"deleted_at,omitempty"`
+	// Tags — метки владельца, отсортированные по алфавиту.
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (m URLModel) Deleted() bool {
+	return m.DeletedAt != nil
+}
+
+func (m URLModel) ClicksExhausted() bool {
+	return m.MaxClicks > 0 && m.Clicks >= m.MaxClicks
+}
+
+func (m URLModel) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Active сообщает, попадает ли now в окно активности [ActiveFrom, ActiveUntil).
+// Вне окна посетитель отправляется на FallbackURL или получает 404.
+func (m URLModel) Active(now time.Time) bool {
+	if m.ActiveFrom != nil && now.Before(*m.ActiveFrom) {
+		return false
+	}
+	return m.ActiveUntil == nil || now.Before(*m.ActiveUntil)
+}
+
+// State возвращает состояние ссылки: deleted — ссылка удалена; expired —
+// окно активности закончилось, истёк срок действия или исчерпан лимит
+// переходов; scheduled — окно ещё не началось; иначе active.
+func (m URLModel) State(now time.Time) string {
+	switch {
+	case m.Deleted():
+		return StateDeleted
+	case m.Expired(now) || m.ClicksExhausted() || (m.ActiveUntil != nil && !now.Before(*m.ActiveUntil)):
+		return StateExpired
+	case m.ActiveFrom != nil && now.Before(*m.ActiveFrom):
+		return StateScheduled
+	}
+	return StateActive
+}
+
+// Variant — один из вариантов адреса назначения для A/B-разделения трафика.
+// Посетитель попадает на вариант с вероятностью Weight/сумма весов; вариант
+// с нулевым весом приостановлен, но его статистика сохраняется.
+type Variant struct {
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+	Clicks      int64  `json:"clicks,omitempty"`
+}
+
+// Rule отправляет посетителя на Destination, если выполнены все заданные
+// условия. Внутри одного условия достаточно совпадения с любым из значений.
+type Rule struct {
+	Destination string      `json:"destination"`
+	UserAgent   string      `json:"user_agent,omitempty"`
+	OS          []string    `json:"os,omitempty"`
+	Languages   []string    `json:"languages,omitempty"`
+	Countries   []string    `json:"countries,omitempty"`
+	Time        *TimeWindow `json:"time,omitempty"`
+}
+
+// TimeWindow — интервал времени суток "15:04" в часовом поясе Timezone (UTC,
+// если не задан) по дням недели Days ("mon" … "sun", любые, если не заданы).
+// From позже To означает интервал через полночь.
+type TimeWindow struct {
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type HistoryEntry struct {
+	ShortURL  string                 `json:"short_url"`
+	Version   int64                  `json:"version"`
+	ChangedAt time.Time              `json:"changed_at"`
+	ChangedBy string                 `json:"changed_by"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// APIKey — ключ доступа к API для серверных клиентов. Хранится только хеш
+// секрета; отозванный или просроченный ключ не принимается.
+type APIKey struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name,omitempty"`
+	Hash      string     `json:"hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k APIKey) Usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
 }
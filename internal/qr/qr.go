@@ -0,0 +1,186 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+)
+
+var ErrorInvalidOptions = errors.New("invalid QR code options")
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options задаёт внешний вид кода. Size — сторона изображения в пикселях,
+// Margin — ширина светлой рамки в модулях (по стандарту нужно не меньше 4).
+type Options struct {
+	Size       int
+	Format     string
+	Level      string
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Size:       DefaultSize,
+		Format:     FormatPNG,
+		Level:      "M",
+		Margin:     DefaultMargin,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("%w: size must be between %d and %d", ErrorInvalidOptions, MinSize, MaxSize)
+	}
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("%w: format must be %q or %q", ErrorInvalidOptions, FormatPNG, FormatSVG)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return fmt.Errorf("%w: ecc must be one of L, M, Q, H", ErrorInvalidOptions)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrorInvalidOptions, MaxMargin)
+	}
+	return nil
+}
+
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// ParseColor разбирает цвет вида "rgb", "rrggbb" или "rrggbbaa" с необязательным #.
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("%w: colour %q must be a hex value", ErrorInvalidOptions, s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%w: colour %q must be a hex value", ErrorInvalidOptions, s)
+	}
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// Render кодирует content и возвращает изображение в формате opts.Format.
+func Render(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, levels[opts.Level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	modules := len(bitmap) + 2*opts.Margin
+	if opts.Size < modules {
+		return nil, fmt.Errorf("%w: size %d is too small for %d modules", ErrorInvalidOptions, opts.Size, modules)
+	}
+
+	if opts.Format == FormatSVG {
+		return renderSVG(bitmap, opts), nil
+	}
+	return renderPNG(bitmap, opts)
+}
+
+// renderPNG рисует модули целым числом пикселей, чтобы код не размывался;
+// остаток размера уходит в рамку поровну с каждой стороны.
+func renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := opts.Size / modules
+	offset := (opts.Size-scale*modules)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				start := img.PixOffset(offset+x*scale, offset+y*scale+dy)
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[start+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, opts Options) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, svgColor(opts.Background))
+
+	buf.WriteString(`<path fill="` + svgColor(opts.Foreground) + `" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// Соседние тёмные модули строки объединяются в один прямоугольник.
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
+
+func svgColor(c color.RGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3f)", c.R, c.G, c.B, float64(c.A)/0xff)
+}
@@ -0,0 +1,80 @@
+package qr
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	data, err := Render("http://localhost:8080/E9wVbL1G", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b}, "рамка светлая")
+
+	var dark bool
+	for x := 0; x < 300 && !dark; x++ {
+		r, g, b, _ := img.At(x, 150).RGBA()
+		dark = r>>8 == 0x11 && g>>8 == 0x22 && b>>8 == 0x33
+	}
+	assert.True(t, dark, "есть модули цвета переднего плана")
+}
+
+func TestRenderSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = FormatSVG
+	opts.Margin = 2
+	opts.Background = color.RGBA{}
+
+	data, err := Render("http://localhost:8080/E9wVbL1G", opts)
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `viewBox="0 0 33 33"`, "версия 3 — 29 модулей и рамка по 2")
+	assert.Contains(t, svg, `d="M2 2h7v1h-7z`, "угловой маркер начинается после рамки")
+	assert.Contains(t, svg, `fill="rgba(0,0,0,0.000)"`)
+}
+
+func TestRenderInvalidOptions(t *testing.T) {
+	tests := []func(*Options){
+		func(o *Options) { o.Size = 10 },
+		func(o *Options) { o.Format = "gif" },
+		func(o *Options) { o.Level = "X" },
+		func(o *Options) { o.Margin = -1 },
+	}
+
+	for _, modify := range tests {
+		opts := DefaultOptions()
+		modify(&opts)
+		_, err := Render("http://localhost:8080/id", opts)
+		assert.ErrorIs(t, err, ErrorInvalidOptions)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := ParseColor("#0af")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x00, G: 0xaa, B: 0xff, A: 0xff}, c)
+
+	c, err = ParseColor("11223380")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x80}, c)
+
+	_, err = ParseColor("red")
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+}
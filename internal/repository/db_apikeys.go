@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/jackc/pgconn"
+	"go.uber.org/zap"
+	"time"
+)
+
+const selectKeyColumns = "id, user_id, name, hash, scopes, created_at, expires_at, revoked_at"
+
+func scanKey(row rowScanner) (model.APIKey, error) {
+	var (
+		key       model.APIKey
+		scopes    []byte
+		expiresAt sql.NullTime
+		revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &scopes, &key.CreatedAt, &expiresAt, &revokedAt); err != nil {
+		return key, err
+	}
+
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return key, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (db *DBRepository) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	query := `INSERT INTO api_keys (` + selectKeyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	ctx, span := startQuerySpan(ctx, "INSERT", query)
+	defer span.End()
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Hash, scopes, key.CreatedAt, key.ExpiresAt, key.RevokedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrorAlreadyExists
+		}
+		logger.FromContext(ctx).Error("Не удалось сохранить API-ключ в DB", zap.String("key_id", key.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db *DBRepository) GetAPIKey(ctx context.Context, id string) (model.APIKey, error) {
+	query := "SELECT " + selectKeyColumns + " FROM api_keys WHERE id = $1"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	key, err := scanKey(db.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.APIKey{}, ErrorNotFound
+		}
+		logger.FromContext(ctx).Error("Не удалось получить API-ключ из DB", zap.String("key_id", id), zap.Error(err))
+		return model.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (db *DBRepository) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	query := "SELECT " + selectKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC, id"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	rows, err := db.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось получить API-ключи из DB", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey отзывает ключ; у уже отозванного ключа время отзыва не меняется.
+func (db *DBRepository) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1"
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	res, err := db.db.ExecContext(ctx, query, id, at)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось отозвать API-ключ в DB", zap.String("key_id", id), zap.Error(err))
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
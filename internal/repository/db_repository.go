@@ -3,8 +3,18 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
 	"github.com/jackc/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type DBRepository struct {
@@ -15,10 +25,53 @@ func NewDBRepository(db *sql.DB) *DBRepository {
 	return &DBRepository{db: db}
 }
 
-func (db *DBRepository) Save(ctx context.Context, id, url string) error {
-	query := "INSERT INTO urls (short_id, original_url) VALUES ($1, $2)"
+func startQuerySpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "SQL "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func (db *DBRepository) Save(ctx context.Context, link model.URLModel) error {
+	query := `INSERT INTO urls (short_id, original_url, disabled, disabled_reason, password_hash, clicks, max_clicks,
+		user_id, version, created_at, expires_at, metadata, interstitial, redirect_type, rules, variants,
+		query_params, query_conflict, forward_query, active_from, active_until, fallback_url, deleted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)`
+	ctx, span := startQuerySpan(ctx, "INSERT", query)
+	defer span.End()
+
+	metadata, err := encodeStringMap(link.Metadata)
+	if err != nil {
+		return err
+	}
+	routing, err := encodeRules(link.Rules)
+	if err != nil {
+		return err
+	}
+	variants, err := encodeVariants(link.Variants)
+	if err != nil {
+		return err
+	}
+	queryParams, err := encodeStringMap(link.QueryParams)
+	if err != nil {
+		return err
+	}
 
-	_, err := db.db.ExecContext(ctx, query, id, url)
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось начать транзакцию", zap.String("id", link.ShortURL), zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, link.ShortURL, link.OriginalURL, link.Disabled, link.DisabledReason,
+		link.PasswordHash, link.Clicks, link.MaxClicks, link.UserID, link.Version, link.CreatedAt, link.ExpiresAt, metadata,
+		link.Interstitial, link.RedirectType, routing, variants, queryParams, link.QueryConflict, link.ForwardQuery,
+		link.ActiveFrom, link.ActiveUntil, link.FallbackURL, link.DeletedAt)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -26,23 +79,507 @@ func (db *DBRepository) Save(ctx context.Context, id, url string) error {
 				return ErrorAlreadyExists
 			}
 		}
+		logger.FromContext(ctx).Error("Не удалось сохранить URL в DB", zap.String("id", link.ShortURL), zap.Error(err))
 		return err
 	}
 
-	return nil
+	if err := attachTags(ctx, tx, link.UserID, link.ShortURL, link.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const linkColumns = "short_id, original_url, disabled, disabled_reason, password_hash, clicks, max_clicks, " +
+	"user_id, version, created_at, expires_at, metadata, interstitial, redirect_type, rules, variants, " +
+	"query_params, query_conflict, forward_query, active_from, active_until, fallback_url, deleted_at"
+
+// selectLinkColumns читает ссылку из urls вместе с её метками.
+const selectLinkColumns = linkColumns + ", " + tagsColumn
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (model.URLModel, error) {
+	var (
+		link        model.URLModel
+		expiresAt   sql.NullTime
+		activeFrom  sql.NullTime
+		activeUntil sql.NullTime
+		deletedAt   sql.NullTime
+		metadata    []byte
+		routing     []byte
+		variants    []byte
+		params      []byte
+		tags        []byte
+	)
+	err := row.Scan(&link.ShortURL, &link.OriginalURL, &link.Disabled, &link.DisabledReason, &link.PasswordHash,
+		&link.Clicks, &link.MaxClicks, &link.UserID, &link.Version, &link.CreatedAt, &expiresAt, &metadata,
+		&link.Interstitial, &link.RedirectType, &routing, &variants, &params, &link.QueryConflict, &link.ForwardQuery,
+		&activeFrom, &activeUntil, &link.FallbackURL, &deletedAt, &tags)
+	if err != nil {
+		return link, err
+	}
+
+	if expiresAt.Valid {
+		link.ExpiresAt = &expiresAt.Time
+	}
+	if activeFrom.Valid {
+		link.ActiveFrom = &activeFrom.Time
+	}
+	if activeUntil.Valid {
+		link.ActiveUntil = &activeUntil.Time
+	}
+	if deletedAt.Valid {
+		link.DeletedAt = &deletedAt.Time
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &link.Metadata); err != nil {
+			return link, err
+		}
+		if len(link.Metadata) == 0 {
+			link.Metadata = nil
+		}
+	}
+	if len(routing) > 0 {
+		if err := json.Unmarshal(routing, &link.Rules); err != nil {
+			return link, err
+		}
+		if len(link.Rules) == 0 {
+			link.Rules = nil
+		}
+	}
+	if len(variants) > 0 {
+		if err := json.Unmarshal(variants, &link.Variants); err != nil {
+			return link, err
+		}
+		if len(link.Variants) == 0 {
+			link.Variants = nil
+		}
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &link.QueryParams); err != nil {
+			return link, err
+		}
+		if len(link.QueryParams) == 0 {
+			link.QueryParams = nil
+		}
+	}
+	if len(tags) > 0 {
+		if err := json.Unmarshal(tags, &link.Tags); err != nil {
+			return link, err
+		}
+		if len(link.Tags) == 0 {
+			link.Tags = nil
+		}
+	}
+	return link, nil
+}
+
+func encodeStringMap(metadata map[string]string) ([]byte, error) {
+	if metadata == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(metadata)
 }
 
-func (db *DBRepository) Get(ctx context.Context, id string) (string, error) {
-	var originalURL string
-	query := "SELECT original_url FROM urls WHERE short_id = $1"
+// encodeVariants сериализует варианты без счётчиков: переходы по вариантам
+// хранятся в url_variant_clicks.
+func encodeVariants(variants []model.Variant) ([]byte, error) {
+	stripped := make([]model.Variant, len(variants))
+	for i, v := range variants {
+		v.Clicks = 0
+		stripped[i] = v
+	}
+	return json.Marshal(stripped)
+}
+
+func encodeRules(routing []model.Rule) ([]byte, error) {
+	if routing == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(routing)
+}
 
-	err := db.db.QueryRowContext(ctx, query, id).Scan(&originalURL)
+func (db *DBRepository) Get(ctx context.Context, id string) (model.URLModel, error) {
+	query := "SELECT " + selectLinkColumns + " FROM urls WHERE short_id = $1"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	link, err := scanLink(db.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrorNotFound
+			return model.URLModel{}, ErrorNotFound
+		}
+		logger.FromContext(ctx).Error("Не удалось получить URL из DB", zap.String("id", id), zap.Error(err))
+		return model.URLModel{}, err
+	}
+
+	if err := db.loadVariantClicks(ctx, &link); err != nil {
+		return model.URLModel{}, err
+	}
+	return link, nil
+}
+
+func (db *DBRepository) loadVariantClicks(ctx context.Context, link *model.URLModel) error {
+	if len(link.Variants) == 0 {
+		return nil
+	}
+
+	query := "SELECT variant_id, clicks FROM url_variant_clicks WHERE short_id = $1"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	rows, err := db.db.QueryContext(ctx, query, link.ShortURL)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось получить переходы по вариантам из DB", zap.String("id", link.ShortURL), zap.Error(err))
+		return err
+	}
+	defer rows.Close()
+
+	clicks := make(map[string]int64)
+	for rows.Next() {
+		var variant string
+		var count int64
+		if err := rows.Scan(&variant, &count); err != nil {
+			return err
 		}
-		return "", err
+		clicks[variant] = count
+	}
+	for i := range link.Variants {
+		link.Variants[i].Clicks = clicks[link.Variants[i].ID]
 	}
 
-	return originalURL, nil
+	return rows.Err()
+}
+
+func (db *DBRepository) Hit(ctx context.Context, id, variant string) (model.URLModel, error) {
+	// Переход по ссылке и по варианту засчитываются одним оператором.
+	query := `WITH hit AS (
+			UPDATE urls SET clicks = clicks + 1
+			WHERE short_id = $1 AND deleted_at IS NULL AND (max_clicks = 0 OR clicks < max_clicks)
+				AND (expires_at IS NULL OR expires_at > now())
+			RETURNING ` + selectLinkColumns + `
+		), counted AS (
+			INSERT INTO url_variant_clicks (short_id, variant_id, clicks)
+			SELECT short_id, $2, 1 FROM hit WHERE $2 <> ''
+			ON CONFLICT (short_id, variant_id) DO UPDATE SET clicks = url_variant_clicks.clicks + 1
+		)
+		SELECT ` + linkColumns + `, tags FROM hit`
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	link, err := scanLink(db.db.QueryRowContext(ctx, query, id, variant))
+	if err == nil {
+		return link, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		logger.FromContext(ctx).Error("Не удалось засчитать переход в DB", zap.String("id", id), zap.Error(err))
+		return model.URLModel{}, err
+	}
+
+	// Условие UPDATE не выполнилось: ссылки либо нет, либо она удалена, лимит
+	// переходов исчерпан или срок истёк.
+	if _, err := db.Get(ctx, id); err != nil {
+		return model.URLModel{}, err
+	}
+	return model.URLModel{}, ErrorGone
+}
+
+// Update меняет редактируемые поля ссылки и пишет entry в url_history в одной
+// транзакции. Запись обновляется, только если её версия равна link.Version-1.
+func (db *DBRepository) Update(ctx context.Context, link model.URLModel, entry model.HistoryEntry) error {
+	query := `UPDATE urls SET original_url = $2, expires_at = $3, metadata = $4, interstitial = $6, redirect_type = $7,
+		rules = $8, variants = $9, query_params = $10, query_conflict = $11, forward_query = $12,
+		active_from = $13, active_until = $14, fallback_url = $15, version = $5
+		WHERE short_id = $1 AND version = $5 - 1`
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	metadata, err := encodeStringMap(link.Metadata)
+	if err != nil {
+		return err
+	}
+	routing, err := encodeRules(link.Rules)
+	if err != nil {
+		return err
+	}
+	variants, err := encodeVariants(link.Variants)
+	if err != nil {
+		return err
+	}
+	queryParams, err := encodeStringMap(link.QueryParams)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось начать транзакцию", zap.String("id", link.ShortURL), zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, link.ShortURL, link.OriginalURL, link.ExpiresAt, metadata, link.Version,
+		link.Interstitial, link.RedirectType, routing, variants, queryParams, link.QueryConflict, link.ForwardQuery,
+		link.ActiveFrom, link.ActiveUntil, link.FallbackURL)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось обновить URL в DB", zap.String("id", link.ShortURL), zap.Error(err))
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// Версия не совпала либо ссылки нет вовсе.
+		if _, err := db.Get(ctx, link.ShortURL); err != nil {
+			return err
+		}
+		return ErrorConflict
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO url_history (short_id, version, changed_at, changed_by, changes) VALUES ($1, $2, $3, $4, $5)`,
+		entry.ShortURL, entry.Version, entry.ChangedAt, entry.ChangedBy, changes)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось записать историю изменений в DB", zap.String("id", link.ShortURL), zap.Error(err))
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DBRepository) History(ctx context.Context, id string) ([]model.HistoryEntry, error) {
+	query := `SELECT version, changed_at, changed_by, changes FROM url_history WHERE short_id = $1 ORDER BY version`
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	if _, err := db.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.QueryContext(ctx, query, id)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось получить историю изменений из DB", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []model.HistoryEntry
+	for rows.Next() {
+		entry := model.HistoryEntry{ShortURL: id}
+		var changes []byte
+		if err := rows.Scan(&entry.Version, &entry.ChangedAt, &entry.ChangedBy, &changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
+
+func (db *DBRepository) SetDisabled(ctx context.Context, id string, disabled bool, reason string) error {
+	query := "UPDATE urls SET disabled = $2, disabled_reason = $3 WHERE short_id = $1"
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	res, err := db.db.ExecContext(ctx, query, id, disabled, reason)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось обновить URL в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (db *DBRepository) ForEach(ctx context.Context, fn func(link model.URLModel) error) error {
+	query := "SELECT " + selectLinkColumns + " FROM urls"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	rows, err := db.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// stateConditions повторяет model.URLModel.State для отбора ссылок в SQL;
+// {now} заменяется параметром с текущим временем.
+var stateConditions = map[string]string{
+	model.StateExpired:   expiredCondition,
+	model.StateScheduled: "NOT (" + expiredCondition + ") AND active_from > {now}",
+	model.StateActive:    "NOT (" + expiredCondition + ") AND (active_from IS NULL OR active_from <= {now})",
+}
+
+const expiredCondition = "(expires_at IS NOT NULL AND expires_at <= {now}) OR (max_clicks > 0 AND clicks >= max_clicks) " +
+	"OR (active_until IS NOT NULL AND active_until <= {now})"
+
+// domainExpression выделяет хост из адреса назначения, как linkDomain.
+const domainExpression = `lower(substring(original_url from '^[^:/?#]+://(?:[^@/?#]*@)?([^/:?#]+)'))`
+
+// listQuery строит запрос для List. Страницы выбираются по ключу (keyset):
+// условие на пару (ключ сортировки, short_id) вместо OFFSET, поэтому
+// глубокие страницы читаются по индексу так же быстро, как первая.
+func listQuery(filter ListFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+arg(filter.UserID))
+	}
+	if filter.State == model.StateDeleted {
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if condition, ok := stateConditions[filter.State]; ok {
+		conditions = append(conditions, "("+strings.ReplaceAll(condition, "{now}", arg(filter.Now))+")")
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedTo))
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, strings.ReplaceAll(tagCondition, "{tag}", arg(filter.Tag)))
+	}
+	if filter.Search != "" {
+		// strpos вместо LIKE: символы % и _ в запросе ищутся буквально.
+		search := arg(filter.Search)
+		conditions = append(conditions, "(strpos(lower(short_id), "+search+") > 0 OR strpos(lower(original_url), "+search+") > 0)")
+	}
+	if filter.Domain != "" {
+		// right вместо LIKE: символы % и _ в домене сравниваются буквально.
+		domain := arg(filter.Domain) + "::text"
+		conditions = append(conditions, "("+domainExpression+" = "+domain+" OR right("+domainExpression+
+			", length("+domain+") + 1) = ('.' || "+domain+"))")
+	}
+
+	column, direction, compare := "created_at", "DESC", "<"
+	if filter.Sort == SortClicks {
+		column = "clicks"
+	}
+	if filter.Ascending {
+		direction, compare = "ASC", ">"
+	}
+	if filter.After != nil {
+		var key any = filter.After.Key
+		if column == "created_at" {
+			key = time.Unix(0, filter.After.Key).UTC()
+		}
+		conditions = append(conditions, "("+column+", short_id) "+compare+" ("+arg(key)+", "+arg(filter.After.ID)+")")
+	}
+
+	query := "SELECT " + selectLinkColumns + " FROM urls WHERE " + strings.Join(conditions, " AND ") +
+		" ORDER BY " + column + " " + direction + ", short_id " + direction
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	return query, args
+}
+
+func (db *DBRepository) List(ctx context.Context, filter ListFilter) ([]model.URLModel, error) {
+	query, args := listQuery(filter)
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось получить список URL из DB", zap.String("user_id", filter.UserID), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []model.URLModel
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func (db *DBRepository) Totals(ctx context.Context) (Totals, error) {
+	query := "SELECT COUNT(*), COUNT(DISTINCT NULLIF(user_id, '')) FROM urls WHERE deleted_at IS NULL"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	var totals Totals
+	if err := db.db.QueryRowContext(ctx, query).Scan(&totals.URLs, &totals.Users); err != nil {
+		logger.FromContext(ctx).Error("Не удалось посчитать URL в DB", zap.Error(err))
+		return Totals{}, err
+	}
+	return totals, nil
+}
+
+func (db *DBRepository) Delete(ctx context.Context, id string, at time.Time) error {
+	query := "UPDATE urls SET deleted_at = $2 WHERE short_id = $1 AND deleted_at IS NULL"
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	res, err := db.db.ExecContext(ctx, query, id, at)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось удалить URL в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// Ничего не обновилось: ссылки нет или она уже удалена.
+	_, err = db.Get(ctx, id)
+	return err
+}
+
+func (db *DBRepository) DeleteUserLinks(ctx context.Context, userID string, at time.Time) (int64, error) {
+	query := "UPDATE urls SET deleted_at = $2 WHERE user_id = $1 AND deleted_at IS NULL"
+	ctx, span := startQuerySpan(ctx, "UPDATE", query)
+	defer span.End()
+
+	res, err := db.db.ExecContext(ctx, query, userID, at)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось удалить URL пользователя в DB", zap.String("user_id", userID), zap.Error(err))
+		return 0, err
+	}
+	return res.RowsAffected()
 }
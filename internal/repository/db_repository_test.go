@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestListQuery(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	created := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	type testCase struct {
+		name     string
+		filter   ListFilter
+		expected string
+		args     []any
+	}
+
+	tests := []testCase{
+		{
+			name:     "по дате создания, по убыванию",
+			filter:   ListFilter{UserID: "owner", Sort: SortCreated},
+			expected: "user_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC, short_id DESC",
+			args:     []any{"owner"},
+		},
+		{
+			name:     "по дате создания, по возрастанию",
+			filter:   ListFilter{UserID: "owner", Sort: SortCreated, Ascending: true, Limit: 21},
+			expected: "user_id = $1 AND deleted_at IS NULL ORDER BY created_at ASC, short_id ASC LIMIT $2",
+			args:     []any{"owner", 21},
+		},
+		{
+			name:   "по дате создания после курсора, по убыванию",
+			filter: ListFilter{UserID: "owner", Sort: SortCreated, After: &Cursor{Key: created.UnixNano(), ID: "l1"}, Limit: 21},
+			expected: "user_id = $1 AND deleted_at IS NULL AND (created_at, short_id) < ($2, $3)" +
+				" ORDER BY created_at DESC, short_id DESC LIMIT $4",
+			args: []any{"owner", created, "l1", 21},
+		},
+		{
+			name:   "по дате создания после курсора, по возрастанию",
+			filter: ListFilter{UserID: "owner", Sort: SortCreated, Ascending: true, After: &Cursor{Key: created.UnixNano(), ID: "l1"}},
+			expected: "user_id = $1 AND deleted_at IS NULL AND (created_at, short_id) > ($2, $3)" +
+				" ORDER BY created_at ASC, short_id ASC",
+			args: []any{"owner", created, "l1"},
+		},
+		{
+			name:     "по переходам, по убыванию",
+			filter:   ListFilter{UserID: "owner", Sort: SortClicks},
+			expected: "user_id = $1 AND deleted_at IS NULL ORDER BY clicks DESC, short_id DESC",
+			args:     []any{"owner"},
+		},
+		{
+			name:     "по переходам, по возрастанию",
+			filter:   ListFilter{UserID: "owner", Sort: SortClicks, Ascending: true},
+			expected: "user_id = $1 AND deleted_at IS NULL ORDER BY clicks ASC, short_id ASC",
+			args:     []any{"owner"},
+		},
+		{
+			name:   "по переходам после курсора, по убыванию",
+			filter: ListFilter{UserID: "owner", Sort: SortClicks, After: &Cursor{Key: 7, ID: "l2"}, Limit: 3},
+			expected: "user_id = $1 AND deleted_at IS NULL AND (clicks, short_id) < ($2, $3)" +
+				" ORDER BY clicks DESC, short_id DESC LIMIT $4",
+			args: []any{"owner", int64(7), "l2", 3},
+		},
+		{
+			name:   "по переходам после курсора, по возрастанию",
+			filter: ListFilter{UserID: "owner", Sort: SortClicks, Ascending: true, After: &Cursor{Key: 7, ID: "l2"}},
+			expected: "user_id = $1 AND deleted_at IS NULL AND (clicks, short_id) > ($2, $3)" +
+				" ORDER BY clicks ASC, short_id ASC",
+			args: []any{"owner", int64(7), "l2"},
+		},
+		{
+			name:   "состояние подставляет {now} одним параметром",
+			filter: ListFilter{UserID: "owner", State: model.StateExpired, Now: now, Sort: SortCreated},
+			expected: "user_id = $1 AND deleted_at IS NULL AND (" +
+				"(expires_at IS NOT NULL AND expires_at <= $2) OR (max_clicks > 0 AND clicks >= max_clicks) " +
+				"OR (active_until IS NOT NULL AND active_until <= $2)) ORDER BY created_at DESC, short_id DESC",
+			args: []any{"owner", now},
+		},
+		{
+			name:     "удалённые ссылки",
+			filter:   ListFilter{UserID: "owner", State: model.StateDeleted, Sort: SortCreated},
+			expected: "user_id = $1 AND deleted_at IS NOT NULL ORDER BY created_at DESC, short_id DESC",
+			args:     []any{"owner"},
+		},
+		{
+			name: "все условия нумеруются по порядку",
+			filter: ListFilter{
+				UserID: "owner", CreatedFrom: &created, CreatedTo: &now, Tag: "promo", Search: "spring",
+				Domain: "a.example", Sort: SortClicks, After: &Cursor{Key: 1, ID: "l0"}, Limit: 5,
+			},
+			expected: "user_id = $1 AND deleted_at IS NULL AND created_at >= $2 AND created_at < $3 AND " +
+				"EXISTS (SELECT 1 FROM url_tags ut JOIN tags t ON t.id = ut.tag_id\n\tWHERE ut.short_id = urls.short_id AND t.name = $4)" +
+				" AND (strpos(lower(short_id), $5) > 0 OR strpos(lower(original_url), $5) > 0)" +
+				" AND (" + domainExpression + " = $6::text OR right(" + domainExpression + ", length($6::text) + 1) = ('.' || $6::text))" +
+				" AND (clicks, short_id) < ($7, $8) ORDER BY clicks DESC, short_id DESC LIMIT $9",
+			args: []any{"owner", created, now, "promo", "spring", "a.example", int64(1), "l0", 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, args := listQuery(test.filter)
+			assert.Equal(t, "SELECT "+selectLinkColumns+" FROM urls WHERE "+test.expected, query)
+			assert.Equal(t, test.args, args)
+		})
+	}
+}
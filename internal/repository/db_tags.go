@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Метки хранятся в таблице tags (одна строка на метку пользователя) и
+// связываются со ссылками через url_tags. Строки tags, оставшиеся без ссылок,
+// не удаляются: Tags и выборки считают только связанные метки.
+
+// tagsColumn собирает метки ссылки в JSON-массив, отсортированный по алфавиту.
+const tagsColumn = `(SELECT COALESCE(jsonb_agg(t.name ORDER BY t.name), '[]'::jsonb)
+	FROM url_tags ut JOIN tags t ON t.id = ut.tag_id WHERE ut.short_id = urls.short_id) AS tags`
+
+// tagCondition отбирает ссылки с меткой, переданной параметром {tag}.
+const tagCondition = `EXISTS (SELECT 1 FROM url_tags ut JOIN tags t ON t.id = ut.tag_id
+	WHERE ut.short_id = urls.short_id AND t.name = {tag})`
+
+// attachTags создаёт недостающие метки пользователя и связывает их со ссылкой.
+// Вызывается внутри транзакции: метку, которую параллельно создала другая
+// транзакция, второй оператор уже видит.
+func attachTags(ctx context.Context, tx *sql.Tx, userID, id string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	names, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO tags (user_id, name)
+		SELECT $1, jsonb_array_elements_text($2::jsonb) ON CONFLICT (user_id, name) DO NOTHING`, userID, names)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось сохранить метки в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO url_tags (short_id, tag_id)
+		SELECT $1, id FROM tags WHERE user_id = $2 AND name IN (SELECT jsonb_array_elements_text($3::jsonb))
+		ON CONFLICT DO NOTHING`, id, userID, names)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось связать метки со ссылкой в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// AddTags блокирует строку ссылки, поэтому параллельные вызовы проверяют
+// limit по очереди и не могут вместе превысить его.
+func (db *DBRepository) AddTags(ctx context.Context, id string, tags []string, limit int) error {
+	query := "SELECT user_id FROM urls WHERE short_id = $1 FOR UPDATE"
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось начать транзакцию", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrorNotFound
+		}
+		logger.FromContext(ctx).Error("Не удалось получить URL из DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+
+	names, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	var total int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (
+		SELECT t.name FROM url_tags ut JOIN tags t ON t.id = ut.tag_id WHERE ut.short_id = $1
+		UNION SELECT jsonb_array_elements_text($2::jsonb)) names`, id, names).Scan(&total)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось посчитать метки в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	if total > limit {
+		return ErrorTooManyTags
+	}
+
+	if err := attachTags(ctx, tx, userID, id, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DBRepository) RemoveTags(ctx context.Context, id string, tags []string) error {
+	query := `DELETE FROM url_tags WHERE short_id = $1
+		AND tag_id IN (SELECT id FROM tags WHERE name IN (SELECT jsonb_array_elements_text($2::jsonb)))`
+	ctx, span := startQuerySpan(ctx, "DELETE", query)
+	defer span.End()
+
+	names, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.db.ExecContext(ctx, query, id, names)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось снять метки в DB", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// Ничего не удалилось: ссылки нет или на ней не было этих меток.
+	_, err = db.Get(ctx, id)
+	return err
+}
+
+func (db *DBRepository) Tags(ctx context.Context, userID string) ([]TagStats, error) {
+	query := `SELECT t.name, COUNT(*), COALESCE(SUM(u.clicks), 0)
+		FROM tags t JOIN url_tags ut ON ut.tag_id = t.id JOIN urls u ON u.short_id = ut.short_id
+		WHERE t.user_id = $1 AND u.deleted_at IS NULL
+		GROUP BY t.name ORDER BY t.name`
+	ctx, span := startQuerySpan(ctx, "SELECT", query)
+	defer span.End()
+
+	rows, err := db.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("Не удалось получить метки из DB", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []TagStats{}
+	for rows.Next() {
+		var stats TagStats
+		if err := rows.Scan(&stats.Tag, &stats.Links, &stats.Clicks); err != nil {
+			return nil, err
+		}
+		list = append(list, stats)
+	}
+	return list, rows.Err()
+}
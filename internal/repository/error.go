@@ -5,4 +5,7 @@ import "errors"
 var (
 	ErrorAlreadyExists = errors.New("an entry with this ID already exists")
 	ErrorNotFound      = errors.New("an entry with this id was not found")
+	ErrorGone          = errors.New("an entry with this id is no longer available")
+	ErrorConflict      = errors.New("an entry with this id was modified concurrently")
+	ErrorTooManyTags   = errors.New("an entry with this id would exceed the tag limit")
 )
@@ -10,20 +10,53 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 )
 
+// historySuffix и keysSuffix дописываются к пути хранилища для файлов истории
+// изменений и API-ключей. Ключи, как и ссылки, дописываются в конец файла при
+// каждом изменении, и побеждает последняя запись.
+const (
+	historySuffix = ".history"
+	keysSuffix    = ".keys"
+)
+
+// clickFlushInterval — как часто фоновая горутина сбрасывает в файл счётчики
+// переходов по ссылкам без лимита переходов. Запись на каждый переход
+// раздувала бы файл строкой на клик; при падении теряются переходы только за
+// этот интервал, при штатной остановке их дописывает Close.
+const clickFlushInterval = 5 * time.Second
+
 type FileRepository struct {
-	urls       map[string]string
+	urls       map[string]model.URLModel
+	history    map[string][]model.HistoryEntry
 	mu         sync.RWMutex
 	filePath   string
 	descriptor *os.File
 	encoder    *json.Encoder
+	historyFD  *os.File
+	historyEnc *json.Encoder
+	keys       map[string]model.APIKey
+	keysFD     *os.File
+	keysEnc    *json.Encoder
+	index      *linkIndex
 	uuidCount  int
+	// unsaved — ссылки, чьи счётчики переходов ещё не записаны в файл.
+	unsaved map[string]struct{}
+	// stopFlush останавливает горутину сброса счётчиков, flushDone
+	// закрывается, когда она завершилась.
+	stopFlush chan struct{}
+	flushDone chan struct{}
+	closeOnce sync.Once
 }
 
 func NewFileRepository(filePath string) (*FileRepository, error) {
 	fileRepository := &FileRepository{
-		urls:      make(map[string]string),
+		urls:      make(map[string]model.URLModel),
+		history:   make(map[string][]model.HistoryEntry),
+		keys:      make(map[string]model.APIKey),
+		index:     newLinkIndex(),
+		unsaved:   make(map[string]struct{}),
 		filePath:  filePath,
 		uuidCount: 0,
 	}
@@ -46,9 +79,110 @@ func NewFileRepository(filePath string) (*FileRepository, error) {
 	fileRepository.descriptor = file
 	fileRepository.encoder = json.NewEncoder(file)
 
+	if err := fileRepository.loadHistory(); err != nil {
+		logger.Log.Error("Не удалось загрузить историю изменений", zap.Error(err))
+		file.Close()
+		return nil, err
+	}
+
+	historyFile, err := os.OpenFile(fileRepository.filePath+historySuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	fileRepository.historyFD = historyFile
+	fileRepository.historyEnc = json.NewEncoder(historyFile)
+
+	if err := fileRepository.loadKeys(); err != nil {
+		logger.Log.Error("Не удалось загрузить API-ключи", zap.Error(err))
+		fileRepository.Close()
+		return nil, err
+	}
+
+	keysFile, err := os.OpenFile(fileRepository.filePath+keysSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fileRepository.Close()
+		return nil, err
+	}
+
+	fileRepository.keysFD = keysFile
+	fileRepository.keysEnc = json.NewEncoder(keysFile)
+
+	fileRepository.stopFlush = make(chan struct{})
+	fileRepository.flushDone = make(chan struct{})
+	go fileRepository.flushLoop()
+
 	return fileRepository, nil
 }
 
+// flushLoop каждые clickFlushInterval дописывает в файл накопленные
+// переходы, пока не будет закрыт stopFlush.
+func (rep *FileRepository) flushLoop() {
+	defer close(rep.flushDone)
+
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rep.stopFlush:
+			return
+		case <-ticker.C:
+			rep.mu.Lock()
+			// Ошибка записи уже в логе, ссылки останутся в unsaved до следующего раза.
+			rep.flushClicks(context.Background())
+			rep.mu.Unlock()
+		}
+	}
+}
+
+func (rep *FileRepository) loadKeys() error {
+	file, err := os.OpenFile(rep.filePath+keysSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+
+	for {
+		var key model.APIKey
+
+		if err = decoder.Decode(&key); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		rep.keys[key.ID] = key
+	}
+}
+
+func (rep *FileRepository) loadHistory() error {
+	file, err := os.OpenFile(rep.filePath+historySuffix, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+
+	for {
+		var entry model.HistoryEntry
+
+		if err = decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		rep.history[entry.ShortURL] = append(rep.history[entry.ShortURL], entry)
+	}
+}
+
 func (rep *FileRepository) loadFromFile() error {
 	file, err := os.OpenFile(rep.filePath, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
@@ -71,7 +205,8 @@ func (rep *FileRepository) loadFromFile() error {
 			return err
 		}
 
-		rep.urls[record.ShortURL] = record.OriginalURL
+		// Изменения записи дописываются в конец файла, поэтому побеждает последняя версия.
+		rep.urls[record.ShortURL] = record
 		if uuid, err := strconv.Atoi(record.UUID); err == nil {
 			if uuid > rep.uuidCount {
 				rep.uuidCount = uuid
@@ -79,10 +214,14 @@ func (rep *FileRepository) loadFromFile() error {
 		}
 	}
 
+	for _, link := range rep.urls {
+		rep.index.add(link)
+	}
+
 	return nil
 }
 
-func (rep *FileRepository) Save(ctx context.Context, id, url string) error {
+func (rep *FileRepository) Save(ctx context.Context, link model.URLModel) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -92,35 +231,52 @@ func (rep *FileRepository) Save(ctx context.Context, id, url string) error {
 	rep.mu.Lock()
 	defer rep.mu.Unlock()
 
-	if _, ok := rep.urls[id]; ok {
+	if _, ok := rep.urls[link.ShortURL]; ok {
 		return ErrorAlreadyExists
 	}
 
-	rep.urls[id] = url
+	rep.uuidCount++
+	link.UUID = strconv.Itoa(rep.uuidCount)
 
-	if rep.encoder == nil {
-		return nil
+	if err := rep.append(ctx, link); err != nil {
+		return err
 	}
 
-	rep.uuidCount++
-	record := model.URLModel{
-		UUID:        strconv.Itoa(rep.uuidCount),
-		ShortURL:    id,
-		OriginalURL: url,
+	rep.urls[link.ShortURL] = link
+	rep.index.add(link)
+	return nil
+}
+
+func (rep *FileRepository) append(ctx context.Context, record model.URLModel) error {
+	if rep.encoder == nil {
+		return nil
 	}
 
 	if err := rep.encoder.Encode(&record); err != nil {
-		logger.Log.Error("Не удалось записать URL в файл", zap.String("path", rep.filePath), zap.Error(err))
+		logger.FromContext(ctx).Error("Не удалось записать URL в файл", zap.String("path", rep.filePath), zap.Error(err))
 		return err
 	}
 
+	// Запись содержит ссылку целиком, вместе с накопленными переходами.
+	delete(rep.unsaved, record.ShortURL)
+	return nil
+}
+
+// flushClicks записывает в файл ссылки с незаписанными переходами.
+// Вызывается под rep.mu.
+func (rep *FileRepository) flushClicks(ctx context.Context) error {
+	for id := range rep.unsaved {
+		if err := rep.append(ctx, rep.urls[id]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (rep *FileRepository) Get(ctx context.Context, id string) (string, error) {
+func (rep *FileRepository) Get(ctx context.Context, id string) (model.URLModel, error) {
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return model.URLModel{}, ctx.Err()
 	default:
 	}
 
@@ -129,13 +285,305 @@ func (rep *FileRepository) Get(ctx context.Context, id string) (string, error) {
 
 	val, ok := rep.urls[id]
 	if !ok {
-		return "", ErrorNotFound
+		return model.URLModel{}, ErrorNotFound
 	}
 
 	return val, nil
 }
 
+func (rep *FileRepository) Hit(ctx context.Context, id, variant string) (model.URLModel, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return model.URLModel{}, ErrorNotFound
+	}
+	if link.Deleted() || link.ClicksExhausted() || link.Expired(time.Now()) {
+		return model.URLModel{}, ErrorGone
+	}
+
+	link.Clicks++
+	link.Variants = countVariantClick(link.Variants, variant)
+	// Счётчик ссылки с лимитом переходов должен пережить перезапуск сразу,
+	// иначе лимит можно превысить. Остальные счётчики пишутся пачкой.
+	if link.MaxClicks > 0 {
+		if err := rep.append(ctx, link); err != nil {
+			return model.URLModel{}, err
+		}
+	}
+
+	rep.urls[id] = link
+	rep.index.setClicks(link, link.Clicks-1)
+
+	if link.MaxClicks == 0 && rep.encoder != nil {
+		rep.unsaved[id] = struct{}{}
+	}
+	return link, nil
+}
+
+// Update заменяет запись, если сохранённая версия предшествует link.Version,
+// и дописывает entry в файл истории.
+func (rep *FileRepository) Update(ctx context.Context, link model.URLModel, entry model.HistoryEntry) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	current, ok := rep.urls[link.ShortURL]
+	if !ok {
+		return ErrorNotFound
+	}
+	if current.Version != link.Version-1 {
+		return ErrorConflict
+	}
+	link = withCounters(link, current)
+
+	if err := rep.append(ctx, link); err != nil {
+		return err
+	}
+	if rep.historyEnc != nil {
+		if err := rep.historyEnc.Encode(&entry); err != nil {
+			logger.FromContext(ctx).Error("Не удалось записать историю изменений", zap.String("path", rep.filePath+historySuffix), zap.Error(err))
+			return err
+		}
+	}
+
+	rep.urls[link.ShortURL] = link
+	rep.history[link.ShortURL] = append(rep.history[link.ShortURL], entry)
+	return nil
+}
+
+func (rep *FileRepository) History(_ context.Context, id string) ([]model.HistoryEntry, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	if _, ok := rep.urls[id]; !ok {
+		return nil, ErrorNotFound
+	}
+
+	return append([]model.HistoryEntry(nil), rep.history[id]...), nil
+}
+
+func (rep *FileRepository) SetDisabled(ctx context.Context, id string, disabled bool, reason string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+
+	link.Disabled = disabled
+	link.DisabledReason = reason
+	if err := rep.append(ctx, link); err != nil {
+		return err
+	}
+
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *FileRepository) ForEach(ctx context.Context, fn func(link model.URLModel) error) error {
+	rep.mu.RLock()
+	links := make([]model.URLModel, 0, len(rep.urls))
+	for _, link := range rep.urls {
+		links = append(links, link)
+	}
+	rep.mu.RUnlock()
+
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rep *FileRepository) List(_ context.Context, filter ListFilter) ([]model.URLModel, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return listLinks(rep.urls, rep.index, filter), nil
+}
+
+func (rep *FileRepository) Totals(_ context.Context) (Totals, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return countTotals(rep.urls), nil
+}
+
+func (rep *FileRepository) Delete(ctx context.Context, id string, at time.Time) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if link.Deleted() {
+		return nil
+	}
+
+	link.DeletedAt = &at
+	if err := rep.append(ctx, link); err != nil {
+		return err
+	}
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *FileRepository) DeleteUserLinks(ctx context.Context, userID string, at time.Time) (int64, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	var deleted int64
+	for id, link := range rep.urls {
+		if link.UserID != userID || link.Deleted() {
+			continue
+		}
+		link.DeletedAt = &at
+		if err := rep.append(ctx, link); err != nil {
+			return deleted, err
+		}
+		rep.urls[id] = link
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (rep *FileRepository) AddTags(ctx context.Context, id string, tags []string, limit int) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+
+	link.Tags = withTags(link.Tags, tags)
+	if len(link.Tags) > limit {
+		return ErrorTooManyTags
+	}
+	if err := rep.append(ctx, link); err != nil {
+		return err
+	}
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *FileRepository) RemoveTags(ctx context.Context, id string, tags []string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+
+	link.Tags = withoutTags(link.Tags, tags)
+	if err := rep.append(ctx, link); err != nil {
+		return err
+	}
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *FileRepository) Tags(_ context.Context, userID string) ([]TagStats, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return countTags(rep.urls, userID), nil
+}
+
+func (rep *FileRepository) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, ok := rep.keys[key.ID]; ok {
+		return ErrorAlreadyExists
+	}
+	if err := rep.appendKey(ctx, key); err != nil {
+		return err
+	}
+
+	rep.keys[key.ID] = key
+	return nil
+}
+
+func (rep *FileRepository) appendKey(ctx context.Context, key model.APIKey) error {
+	if rep.keysEnc == nil {
+		return nil
+	}
+
+	if err := rep.keysEnc.Encode(&key); err != nil {
+		logger.FromContext(ctx).Error("Не удалось записать API-ключ в файл", zap.String("path", rep.filePath+keysSuffix), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rep *FileRepository) GetAPIKey(_ context.Context, id string) (model.APIKey, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	key, ok := rep.keys[id]
+	if !ok {
+		return model.APIKey{}, ErrorNotFound
+	}
+	return key, nil
+}
+
+func (rep *FileRepository) ListAPIKeys(_ context.Context, userID string) ([]model.APIKey, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return userKeys(rep.keys, userID), nil
+}
+
+func (rep *FileRepository) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	key, ok := rep.keys[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	key.RevokedAt = &at
+	if err := rep.appendKey(ctx, key); err != nil {
+		return err
+	}
+
+	rep.keys[id] = key
+	return nil
+}
+
+// Close останавливает фоновый сброс, дописывает незаписанные переходы и
+// закрывает файлы.
 func (rep *FileRepository) Close() error {
+	rep.closeOnce.Do(func() {
+		if rep.stopFlush != nil {
+			close(rep.stopFlush)
+			<-rep.flushDone
+		}
+	})
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	rep.flushClicks(context.Background())
+	if rep.keysFD != nil {
+		rep.keysFD.Close()
+	}
+	if rep.historyFD != nil {
+		rep.historyFD.Close()
+	}
 	if rep.descriptor != nil {
 		return rep.descriptor.Close()
 	}
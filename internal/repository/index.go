@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"cmp"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"slices"
+)
+
+// Порядки сортировки List.
+const (
+	SortCreated = "created"
+	SortClicks  = "clicks"
+)
+
+func ValidSort(sort string) bool {
+	return sort == SortCreated || sort == SortClicks
+}
+
+// Cursor — позиция в выдаче List: ключ сортировки и идентификатор последней
+// отданной ссылки. Следующая страница начинается сразу после неё.
+type Cursor struct {
+	Key int64
+	ID  string
+}
+
+// SortKey возвращает ключ, по которому ссылка упорядочивается при сортировке sort.
+func SortKey(link model.URLModel, sort string) int64 {
+	if sort == SortClicks {
+		return link.Clicks
+	}
+	return link.CreatedAt.UnixNano()
+}
+
+func compareCursors(a, b Cursor) int {
+	if c := cmp.Compare(a.Key, b.Key); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// orderedIndex — идентификаторы ссылок, упорядоченные по возрастанию
+// (ключ, идентификатор). Вставка и удаление — двоичным поиском.
+type orderedIndex []Cursor
+
+func (ix *orderedIndex) insert(entry Cursor) {
+	i, found := slices.BinarySearchFunc(*ix, entry, compareCursors)
+	if !found {
+		*ix = slices.Insert(*ix, i, entry)
+	}
+}
+
+func (ix *orderedIndex) remove(entry Cursor) {
+	if i, found := slices.BinarySearchFunc(*ix, entry, compareCursors); found {
+		*ix = slices.Delete(*ix, i, i+1)
+	}
+}
+
+// scan обходит индекс от позиции после after (с начала, если after nil) в
+// заданном направлении, пока fn возвращает true.
+func (ix orderedIndex) scan(after *Cursor, ascending bool, fn func(id string) bool) {
+	if ascending {
+		start := 0
+		if after != nil {
+			i, found := slices.BinarySearchFunc(ix, *after, compareCursors)
+			if found {
+				i++
+			}
+			start = i
+		}
+		for _, entry := range ix[start:] {
+			if !fn(entry.ID) {
+				return
+			}
+		}
+		return
+	}
+
+	start := len(ix) - 1
+	if after != nil {
+		i, _ := slices.BinarySearchFunc(ix, *after, compareCursors)
+		start = i - 1
+	}
+	for i := start; i >= 0; i-- {
+		if !fn(ix[i].ID) {
+			return
+		}
+	}
+}
+
+// linkIndex хранит для каждого пользователя ссылки, упорядоченные по дате
+// создания и по числу переходов, чтобы List не сортировал их при каждом
+// запросе. Удалённые ссылки остаются в индексе и отсеиваются фильтром.
+type linkIndex struct {
+	users map[string]*userIndex
+}
+
+type userIndex struct {
+	created orderedIndex
+	clicks  orderedIndex
+}
+
+func newLinkIndex() *linkIndex {
+	return &linkIndex{users: make(map[string]*userIndex)}
+}
+
+func (ix *linkIndex) add(link model.URLModel) {
+	user, ok := ix.users[link.UserID]
+	if !ok {
+		user = &userIndex{}
+		ix.users[link.UserID] = user
+	}
+	user.created.insert(Cursor{Key: SortKey(link, SortCreated), ID: link.ShortURL})
+	user.clicks.insert(Cursor{Key: link.Clicks, ID: link.ShortURL})
+}
+
+// setClicks переставляет ссылку в индексе по переходам после их изменения.
+func (ix *linkIndex) setClicks(link model.URLModel, oldClicks int64) {
+	user, ok := ix.users[link.UserID]
+	if !ok || oldClicks == link.Clicks {
+		return
+	}
+	user.clicks.remove(Cursor{Key: oldClicks, ID: link.ShortURL})
+	user.clicks.insert(Cursor{Key: link.Clicks, ID: link.ShortURL})
+}
+
+// ordered возвращает индекс ссылок пользователя для сортировки sort.
+func (ix *linkIndex) ordered(userID, sort string) orderedIndex {
+	user, ok := ix.users[userID]
+	if !ok {
+		return nil
+	}
+	if sort == SortClicks {
+		return user.clicks
+	}
+	return user.created
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/metrics"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const tracerName = "github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+
+type InstrumentedRepository struct {
+	next    URLRepository
+	backend string
+}
+
+func NewInstrumentedRepository(next URLRepository, backend string) *InstrumentedRepository {
+	return &InstrumentedRepository{
+		next:    next,
+		backend: backend,
+	}
+}
+
+func (rep *InstrumentedRepository) start(ctx context.Context, operation, id string) (context.Context, trace.Span, time.Time) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "repository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("repository.backend", rep.backend),
+			attribute.String("shortener.id", id),
+		),
+	)
+	return ctx, span, time.Now()
+}
+
+func (rep *InstrumentedRepository) observe(span trace.Span, operation string, start time.Time, err error) {
+	defer span.End()
+
+	metrics.RepositoryOperationDuration.WithLabelValues(rep.backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, ErrorNotFound) && !errors.Is(err, ErrorGone) && !errors.Is(err, ErrorConflict) {
+		metrics.RepositoryErrorsTotal.WithLabelValues(rep.backend, operation).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (rep *InstrumentedRepository) Save(ctx context.Context, link model.URLModel) error {
+	ctx, span, start := rep.start(ctx, "save", link.ShortURL)
+	err := rep.next.Save(ctx, link)
+	rep.observe(span, "save", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) Get(ctx context.Context, id string) (model.URLModel, error) {
+	ctx, span, start := rep.start(ctx, "get", id)
+	link, err := rep.next.Get(ctx, id)
+	rep.observe(span, "get", start, err)
+	return link, err
+}
+
+func (rep *InstrumentedRepository) Hit(ctx context.Context, id, variant string) (model.URLModel, error) {
+	ctx, span, start := rep.start(ctx, "hit", id)
+	link, err := rep.next.Hit(ctx, id, variant)
+	rep.observe(span, "hit", start, err)
+	return link, err
+}
+
+func (rep *InstrumentedRepository) Update(ctx context.Context, link model.URLModel, entry model.HistoryEntry) error {
+	ctx, span, start := rep.start(ctx, "update", link.ShortURL)
+	err := rep.next.Update(ctx, link, entry)
+	rep.observe(span, "update", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) History(ctx context.Context, id string) ([]model.HistoryEntry, error) {
+	ctx, span, start := rep.start(ctx, "history", id)
+	history, err := rep.next.History(ctx, id)
+	rep.observe(span, "history", start, err)
+	return history, err
+}
+
+func (rep *InstrumentedRepository) SetDisabled(ctx context.Context, id string, disabled bool, reason string) error {
+	ctx, span, start := rep.start(ctx, "set_disabled", id)
+	err := rep.next.SetDisabled(ctx, id, disabled, reason)
+	rep.observe(span, "set_disabled", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) ForEach(ctx context.Context, fn func(link model.URLModel) error) error {
+	ctx, span, start := rep.start(ctx, "for_each", "")
+	err := rep.next.ForEach(ctx, fn)
+	rep.observe(span, "for_each", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) List(ctx context.Context, filter ListFilter) ([]model.URLModel, error) {
+	ctx, span, start := rep.start(ctx, "list", "")
+	links, err := rep.next.List(ctx, filter)
+	rep.observe(span, "list", start, err)
+	return links, err
+}
+
+func (rep *InstrumentedRepository) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	ctx, span, start := rep.start(ctx, "save_api_key", "")
+	err := rep.next.SaveAPIKey(ctx, key)
+	rep.observe(span, "save_api_key", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) GetAPIKey(ctx context.Context, id string) (model.APIKey, error) {
+	ctx, span, start := rep.start(ctx, "get_api_key", "")
+	key, err := rep.next.GetAPIKey(ctx, id)
+	rep.observe(span, "get_api_key", start, err)
+	return key, err
+}
+
+func (rep *InstrumentedRepository) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ctx, span, start := rep.start(ctx, "list_api_keys", "")
+	keys, err := rep.next.ListAPIKeys(ctx, userID)
+	rep.observe(span, "list_api_keys", start, err)
+	return keys, err
+}
+
+func (rep *InstrumentedRepository) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span, start := rep.start(ctx, "revoke_api_key", "")
+	err := rep.next.RevokeAPIKey(ctx, id, at)
+	rep.observe(span, "revoke_api_key", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) Totals(ctx context.Context) (Totals, error) {
+	ctx, span, start := rep.start(ctx, "totals", "")
+	totals, err := rep.next.Totals(ctx)
+	rep.observe(span, "totals", start, err)
+	return totals, err
+}
+
+func (rep *InstrumentedRepository) Delete(ctx context.Context, id string, at time.Time) error {
+	ctx, span, start := rep.start(ctx, "delete", id)
+	err := rep.next.Delete(ctx, id, at)
+	rep.observe(span, "delete", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) DeleteUserLinks(ctx context.Context, userID string, at time.Time) (int64, error) {
+	ctx, span, start := rep.start(ctx, "delete_user_links", "")
+	deleted, err := rep.next.DeleteUserLinks(ctx, userID, at)
+	rep.observe(span, "delete_user_links", start, err)
+	return deleted, err
+}
+
+func (rep *InstrumentedRepository) AddTags(ctx context.Context, id string, tags []string, limit int) error {
+	ctx, span, start := rep.start(ctx, "add_tags", id)
+	err := rep.next.AddTags(ctx, id, tags, limit)
+	rep.observe(span, "add_tags", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) RemoveTags(ctx context.Context, id string, tags []string) error {
+	ctx, span, start := rep.start(ctx, "remove_tags", id)
+	err := rep.next.RemoveTags(ctx, id, tags)
+	rep.observe(span, "remove_tags", start, err)
+	return err
+}
+
+func (rep *InstrumentedRepository) Tags(ctx context.Context, userID string) ([]TagStats, error) {
+	ctx, span, start := rep.start(ctx, "tags", "")
+	tags, err := rep.next.Tags(ctx, userID)
+	rep.observe(span, "tags", start, err)
+	return tags, err
+}
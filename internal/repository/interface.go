@@ -1,8 +1,74 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"time"
+)
+
+// Totals — сводные показатели хранилища без учёта удалённых ссылок.
+type Totals struct {
+	URLs  int64 `json:"urls"`
+	Users int64 `json:"users"`
+}
+
+// ListFilter отбирает ссылки для List. Пустые поля выборку не ограничивают;
+// State сравнивается с model.URLModel.State(Now), а удалённые ссылки
+// отдаются только при State = model.StateDeleted.
+type ListFilter struct {
+	UserID string
+	State  string
+	Now    time.Time
+	// Domain — хост адреса назначения; поддомены тоже подходят.
+	Domain string
+	// CreatedFrom и CreatedTo задают полуинтервал [CreatedFrom, CreatedTo).
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Tag         string
+	// Search — подстрока идентификатора или адреса назначения в нижнем
+	// регистре.
+	Search string
+
+	// Sort — SortCreated (по умолчанию) или SortClicks; по умолчанию по
+	// убыванию. After продолжает выдачу после курсора, Limit = 0 — без
+	// ограничения.
+	Sort      string
+	Ascending bool
+	After     *Cursor
+	Limit     int
+}
 
 type URLRepository interface {
-	Save(ctx context.Context, id, url string) error
-	Get(ctx context.Context, id string) (string, error)
+	Save(ctx context.Context, link model.URLModel) error
+	Get(ctx context.Context, id string) (model.URLModel, error)
+	// Hit засчитывает переход по ссылке и, если variant не пуст, по её варианту.
+	Hit(ctx context.Context, id, variant string) (model.URLModel, error)
+	Update(ctx context.Context, link model.URLModel, entry model.HistoryEntry) error
+	History(ctx context.Context, id string) ([]model.HistoryEntry, error)
+	SetDisabled(ctx context.Context, id string, disabled bool, reason string) error
+	ForEach(ctx context.Context, fn func(link model.URLModel) error) error
+	// List возвращает ссылки, подходящие под filter, упорядоченные по
+	// (ключ сортировки, идентификатор).
+	List(ctx context.Context, filter ListFilter) ([]model.URLModel, error)
+	Totals(ctx context.Context) (Totals, error)
+	// Delete помечает ссылку удалённой; повторное удаление не ошибка.
+	Delete(ctx context.Context, id string, at time.Time) error
+	// DeleteUserLinks помечает удалёнными все ссылки пользователя и
+	// возвращает их число.
+	DeleteUserLinks(ctx context.Context, userID string, at time.Time) (int64, error)
+
+	// AddTags и RemoveTags меняют метки ссылки в обход версии. AddTags
+	// возвращает ErrorTooManyTags, если меток станет больше limit; проверка
+	// и запись атомарны относительно других вызовов AddTags.
+	AddTags(ctx context.Context, id string, tags []string, limit int) error
+	RemoveTags(ctx context.Context, id string, tags []string) error
+	// Tags возвращает метки пользователя по алфавиту; метки без неудалённых
+	// ссылок не возвращаются.
+	Tags(ctx context.Context, userID string) ([]TagStats, error)
+
+	SaveAPIKey(ctx context.Context, key model.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (model.APIKey, error)
+	// ListAPIKeys возвращает ключи пользователя, включая отозванные, от новых к старым.
+	ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error
 }
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"cmp"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// match сообщает, подходит ли ссылка под условия фильтра, кроме курсора.
+func (filter ListFilter) match(link model.URLModel) bool {
+	if filter.UserID != "" && link.UserID != filter.UserID {
+		return false
+	}
+	if link.Deleted() != (filter.State == model.StateDeleted) {
+		return false
+	}
+	if filter.State != "" && link.State(filter.Now) != filter.State {
+		return false
+	}
+	if filter.CreatedFrom != nil && link.CreatedAt.Before(*filter.CreatedFrom) {
+		return false
+	}
+	if filter.CreatedTo != nil && !link.CreatedAt.Before(*filter.CreatedTo) {
+		return false
+	}
+	if filter.Tag != "" && !slices.Contains(link.Tags, filter.Tag) {
+		return false
+	}
+	if filter.Search != "" && !strings.Contains(strings.ToLower(link.ShortURL), filter.Search) &&
+		!strings.Contains(strings.ToLower(link.OriginalURL), filter.Search) {
+		return false
+	}
+	if filter.Domain != "" {
+		host := linkDomain(link.OriginalURL)
+		if host != filter.Domain && !strings.HasSuffix(host, "."+filter.Domain) {
+			return false
+		}
+	}
+	return true
+}
+
+func linkDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// listLinks выполняет List для хранилищ, держащих всё в памяти: обходит
+// упорядоченный индекс пользователя с позиции курсора и отбирает ссылки
+// фильтром.
+func listLinks(urls map[string]model.URLModel, index *linkIndex, filter ListFilter) []model.URLModel {
+	ordered := index.ordered(filter.UserID, filter.Sort)
+	if filter.UserID == "" {
+		// Индекс ведётся по пользователям; общий порядок строится на месте.
+		ordered = make(orderedIndex, 0, len(urls))
+		for _, link := range urls {
+			ordered = append(ordered, Cursor{Key: SortKey(link, filter.Sort), ID: link.ShortURL})
+		}
+		slices.SortFunc(ordered, compareCursors)
+	}
+
+	var links []model.URLModel
+	ordered.scan(filter.After, filter.Ascending, func(id string) bool {
+		if link := urls[id]; filter.match(link) {
+			links = append(links, link)
+		}
+		return filter.Limit == 0 || len(links) < filter.Limit
+	})
+	return links
+}
+
+func userKeys(keys map[string]model.APIKey, userID string) []model.APIKey {
+	var list []model.APIKey
+	for _, key := range keys {
+		if key.UserID == userID {
+			list = append(list, key)
+		}
+	}
+
+	slices.SortFunc(list, func(a, b model.APIKey) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return list
+}
+
+func countTotals(urls map[string]model.URLModel) Totals {
+	var totals Totals
+	users := make(map[string]struct{})
+	for _, link := range urls {
+		if link.Deleted() {
+			continue
+		}
+		totals.URLs++
+		if link.UserID != "" {
+			users[link.UserID] = struct{}{}
+		}
+	}
+	totals.Users = int64(len(users))
+	return totals
+}
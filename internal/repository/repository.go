@@ -2,40 +2,298 @@ package repository
 
 import (
 	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
 	"sync"
+	"time"
 )
 
 type MemoryRepository struct {
-	urls map[string]string
-	mu   sync.RWMutex
+	urls    map[string]model.URLModel
+	history map[string][]model.HistoryEntry
+	keys    map[string]model.APIKey
+	index   *linkIndex
+	mu      sync.RWMutex
 }
 
 func NewMemoryRepository() *MemoryRepository {
 	return &MemoryRepository{
-		urls: make(map[string]string),
+		urls:    make(map[string]model.URLModel),
+		history: make(map[string][]model.HistoryEntry),
+		keys:    make(map[string]model.APIKey),
+		index:   newLinkIndex(),
 	}
 }
 
-func (rep *MemoryRepository) Save(_ context.Context, id, url string) error {
+func (rep *MemoryRepository) Save(_ context.Context, link model.URLModel) error {
 	rep.mu.Lock()
 	defer rep.mu.Unlock()
 
-	_, ok := rep.urls[id]
+	_, ok := rep.urls[link.ShortURL]
 	if ok {
 		return ErrorAlreadyExists
 	}
 
-	rep.urls[id] = url
+	rep.urls[link.ShortURL] = link
+	rep.index.add(link)
 	return nil
 }
 
-func (rep *MemoryRepository) Get(_ context.Context, id string) (string, error) {
+func (rep *MemoryRepository) Get(_ context.Context, id string) (model.URLModel, error) {
 	rep.mu.RLock()
 	defer rep.mu.RUnlock()
 	value, ok := rep.urls[id]
 	if !ok {
-		return "", ErrorNotFound
+		return model.URLModel{}, ErrorNotFound
 	}
 
 	return value, nil
 }
+
+func (rep *MemoryRepository) Hit(_ context.Context, id, variant string) (model.URLModel, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return model.URLModel{}, ErrorNotFound
+	}
+	if link.Deleted() || link.ClicksExhausted() || link.Expired(time.Now()) {
+		return model.URLModel{}, ErrorGone
+	}
+
+	link.Clicks++
+	link.Variants = countVariantClick(link.Variants, variant)
+	rep.urls[id] = link
+	rep.index.setClicks(link, link.Clicks-1)
+	return link, nil
+}
+
+func (rep *MemoryRepository) Update(_ context.Context, link model.URLModel, entry model.HistoryEntry) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	current, ok := rep.urls[link.ShortURL]
+	if !ok {
+		return ErrorNotFound
+	}
+	if current.Version != link.Version-1 {
+		return ErrorConflict
+	}
+	link = withCounters(link, current)
+
+	rep.urls[link.ShortURL] = link
+	rep.history[link.ShortURL] = append(rep.history[link.ShortURL], entry)
+	return nil
+}
+
+// withCounters переносит в обновлённую запись поля, которые меняются в обход
+// версии: UUID, счётчики переходов, признаки блокировки и удаления, метки.
+func withCounters(link, current model.URLModel) model.URLModel {
+	link.UUID = current.UUID
+	link.Clicks = current.Clicks
+	link.Disabled = current.Disabled
+	link.DisabledReason = current.DisabledReason
+	link.DeletedAt = current.DeletedAt
+	link.Tags = current.Tags
+
+	clicks := make(map[string]int64, len(current.Variants))
+	for _, v := range current.Variants {
+		clicks[v.ID] = v.Clicks
+	}
+	variants := make([]model.Variant, len(link.Variants))
+	for i, v := range link.Variants {
+		v.Clicks = clicks[v.ID]
+		variants[i] = v
+	}
+	if len(variants) > 0 {
+		link.Variants = variants
+	}
+	return link
+}
+
+// countVariantClick возвращает копию вариантов с засчитанным переходом по
+// variant. Копия нужна, чтобы не менять срезы, уже отданные вызывающим.
+func countVariantClick(variants []model.Variant, variant string) []model.Variant {
+	if variant == "" || len(variants) == 0 {
+		return variants
+	}
+
+	counted := make([]model.Variant, len(variants))
+	copy(counted, variants)
+	for i := range counted {
+		if counted[i].ID == variant {
+			counted[i].Clicks++
+		}
+	}
+	return counted
+}
+
+func (rep *MemoryRepository) History(_ context.Context, id string) ([]model.HistoryEntry, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	if _, ok := rep.urls[id]; !ok {
+		return nil, ErrorNotFound
+	}
+
+	return append([]model.HistoryEntry(nil), rep.history[id]...), nil
+}
+
+func (rep *MemoryRepository) SetDisabled(_ context.Context, id string, disabled bool, reason string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+
+	link.Disabled = disabled
+	link.DisabledReason = reason
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *MemoryRepository) ForEach(ctx context.Context, fn func(link model.URLModel) error) error {
+	rep.mu.RLock()
+	links := make([]model.URLModel, 0, len(rep.urls))
+	for _, link := range rep.urls {
+		links = append(links, link)
+	}
+	rep.mu.RUnlock()
+
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rep *MemoryRepository) List(_ context.Context, filter ListFilter) ([]model.URLModel, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return listLinks(rep.urls, rep.index, filter), nil
+}
+
+func (rep *MemoryRepository) SaveAPIKey(_ context.Context, key model.APIKey) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, ok := rep.keys[key.ID]; ok {
+		return ErrorAlreadyExists
+	}
+	rep.keys[key.ID] = key
+	return nil
+}
+
+func (rep *MemoryRepository) GetAPIKey(_ context.Context, id string) (model.APIKey, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	key, ok := rep.keys[id]
+	if !ok {
+		return model.APIKey{}, ErrorNotFound
+	}
+	return key, nil
+}
+
+func (rep *MemoryRepository) ListAPIKeys(_ context.Context, userID string) ([]model.APIKey, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return userKeys(rep.keys, userID), nil
+}
+
+func (rep *MemoryRepository) RevokeAPIKey(_ context.Context, id string, at time.Time) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	key, ok := rep.keys[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		rep.keys[id] = key
+	}
+	return nil
+}
+
+func (rep *MemoryRepository) Totals(_ context.Context) (Totals, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return countTotals(rep.urls), nil
+}
+
+func (rep *MemoryRepository) Delete(_ context.Context, id string, at time.Time) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if !link.Deleted() {
+		link.DeletedAt = &at
+		rep.urls[id] = link
+	}
+	return nil
+}
+
+func (rep *MemoryRepository) DeleteUserLinks(_ context.Context, userID string, at time.Time) (int64, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	var deleted int64
+	for id, link := range rep.urls {
+		if link.UserID != userID || link.Deleted() {
+			continue
+		}
+		link.DeletedAt = &at
+		rep.urls[id] = link
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (rep *MemoryRepository) AddTags(_ context.Context, id string, tags []string, limit int) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	link.Tags = withTags(link.Tags, tags)
+	if len(link.Tags) > limit {
+		return ErrorTooManyTags
+	}
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *MemoryRepository) RemoveTags(_ context.Context, id string, tags []string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	link, ok := rep.urls[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	link.Tags = withoutTags(link.Tags, tags)
+	rep.urls[id] = link
+	return nil
+}
+
+func (rep *MemoryRepository) Tags(_ context.Context, userID string) ([]TagStats, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	return countTags(rep.urls, userID), nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"cmp"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"slices"
+)
+
+// TagStats — метка пользователя с числом её неудалённых ссылок и суммой
+// переходов по ним.
+type TagStats struct {
+	Tag    string `json:"tag"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// withTags возвращает отсортированную копию current с добавленными tags.
+// Копия нужна, чтобы не менять срезы, уже отданные вызывающим.
+func withTags(current, tags []string) []string {
+	merged := append(slices.Clone(current), tags...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// withoutTags возвращает копию current без tags или nil, если меток не осталось.
+func withoutTags(current, tags []string) []string {
+	var kept []string
+	for _, tag := range current {
+		if !slices.Contains(tags, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+func countTags(urls map[string]model.URLModel, userID string) []TagStats {
+	counts := make(map[string]*TagStats)
+	for _, link := range urls {
+		if link.UserID != userID || link.Deleted() {
+			continue
+		}
+		for _, tag := range link.Tags {
+			stats, ok := counts[tag]
+			if !ok {
+				stats = &TagStats{Tag: tag}
+				counts[tag] = stats
+			}
+			stats.Links++
+			stats.Clicks += link.Clicks
+		}
+	}
+
+	list := make([]TagStats, 0, len(counts))
+	for _, stats := range counts {
+		list = append(list, *stats)
+	}
+	slices.SortFunc(list, func(a, b TagStats) int {
+		return cmp.Compare(a.Tag, b.Tag)
+	})
+	return list
+}
@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Param — параметр запроса; в отличие от url.Values сохраняет порядок.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// ExpandParams подставляет в значения шаблонов переменные вида {name} из vars
+// и возвращает параметры, упорядоченные по ключу.
+func ExpandParams(templates map[string]string, vars map[string]string) []Param {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	params := make([]Param, 0, len(templates))
+	for key, value := range templates {
+		params = append(params, Param{Key: key, Value: replacer.Replace(value)})
+	}
+	slices.SortFunc(params, func(a, b Param) int { return strings.Compare(a.Key, b.Key) })
+	return params
+}
+
+// ParseQuery разбирает строку запроса, сохраняя порядок параметров.
+// Части, которые не удаётся декодировать, пропускаются.
+func ParseQuery(rawQuery string) []Param {
+	var params []Param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, err := decodePair(part)
+		if err != nil || key == "" {
+			continue
+		}
+		params = append(params, Param{Key: key, Value: value})
+	}
+	return params
+}
+
+func decodePair(part string) (string, string, error) {
+	rawKey, rawValue, _ := strings.Cut(part, "=")
+	key, err := url.QueryUnescape(rawKey)
+	if err != nil {
+		return "", "", err
+	}
+	value, err := url.QueryUnescape(rawValue)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// MergeQuery добавляет params к строке запроса destination. Если параметр с
+// таким ключом уже есть в destination, policy решает: QueryKeep оставляет
+// прежнее значение, QueryOverride заменяет его, QueryAppend добавляет ещё одно.
+// Повторяющиеся ключи внутри params добавляются все. Нетронутые части строки
+// запроса и фрагмент сохраняются как есть.
+func MergeQuery(destination string, params []Param, policy string) (string, error) {
+	if len(params) == 0 {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	if u.RawQuery != "" {
+		parts = strings.Split(u.RawQuery, "&")
+	}
+	present := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		if key, _, err := decodePair(part); err == nil {
+			present[key] = true
+		}
+	}
+
+	replaced := make(map[string]bool)
+	for _, p := range params {
+		switch {
+		case !present[p.Key]:
+		case policy == model.QueryAppend:
+		case policy == model.QueryOverride:
+			if !replaced[p.Key] {
+				parts = slices.DeleteFunc(parts, func(part string) bool {
+					key, _, err := decodePair(part)
+					return err == nil && key == p.Key
+				})
+				replaced[p.Key] = true
+			}
+		default:
+			continue
+		}
+		parts = append(parts, url.QueryEscape(p.Key)+"="+url.QueryEscape(p.Value))
+	}
+
+	u.RawQuery = strings.Join(parts, "&")
+	return u.String(), nil
+}
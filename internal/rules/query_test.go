@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMergeQuery(t *testing.T) {
+	params := []Param{{Key: "utm_source", Value: "mail"}, {Key: "ref", Value: "a b"}}
+
+	type testCase struct {
+		name        string
+		destination string
+		policy      string
+		want        string
+	}
+
+	tests := []testCase{
+		{
+			name:        "без параметров в адресе",
+			destination: "https://shop.example/item#top",
+			policy:      model.QueryKeep,
+			want:        "https://shop.example/item?utm_source=mail&ref=a+b#top",
+		},
+		{
+			name:        "keep",
+			destination: "https://shop.example/?b=%7E&utm_source=site",
+			policy:      model.QueryKeep,
+			want:        "https://shop.example/?b=%7E&utm_source=site&ref=a+b",
+		},
+		{
+			name:        "по умолчанию keep",
+			destination: "https://shop.example/?utm_source=site",
+			want:        "https://shop.example/?utm_source=site&ref=a+b",
+		},
+		{
+			name:        "override",
+			destination: "https://shop.example/?utm_source=site&b=1&utm_source=x",
+			policy:      model.QueryOverride,
+			want:        "https://shop.example/?b=1&utm_source=mail&ref=a+b",
+		},
+		{
+			name:        "append",
+			destination: "https://shop.example/?utm_source=site",
+			policy:      model.QueryAppend,
+			want:        "https://shop.example/?utm_source=site&utm_source=mail&ref=a+b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := MergeQuery(test.destination, params, test.policy)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestMergeQueryRepeatedKeys(t *testing.T) {
+	forwarded := ParseQuery("tag=a&tag=b&=skipped&bad=%zz")
+	assert.Equal(t, []Param{{Key: "tag", Value: "a"}, {Key: "tag", Value: "b"}}, forwarded)
+
+	got, err := MergeQuery("https://shop.example/?tag=x", forwarded, model.QueryOverride)
+	require.NoError(t, err)
+	assert.Equal(t, "https://shop.example/?tag=a&tag=b", got)
+}
+
+func TestExpandParams(t *testing.T) {
+	params := ExpandParams(map[string]string{
+		"utm_source":   "short",
+		"utm_campaign": "{id}-{country}",
+		"utm_content":  "{unknown}",
+	}, map[string]string{"id": "abc", "country": "DE"})
+
+	assert.Equal(t, []Param{
+		{Key: "utm_campaign", Value: "abc-DE"},
+		{Key: "utm_content", Value: "{unknown}"},
+		{Key: "utm_source", Value: "short"},
+	}, params)
+}
@@ -0,0 +1,324 @@
+package rules
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+	OSOther    = "other"
+
+	clockLayout = "15:04"
+
+	// maxPatternLength ограничивает длину шаблона user_agent, maxPatterns —
+	// число скомпилированных шаблонов, которые держит кеш.
+	maxPatternLength = 256
+	maxPatterns      = 1024
+)
+
+var (
+	ErrorInvalidRule = errors.New("invalid routing rule")
+
+	knownOS  = []string{OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSChromeOS, OSOther}
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+
+	// Скомпилированные шаблоны user_agent переиспользуются между запросами.
+	patterns = newPatternCache(maxPatterns)
+)
+
+// patternCache хранит последние использованные шаблоны и вытесняет самые
+// давние, чтобы память не росла с числом правил всех ссылок.
+type patternCache struct {
+	limit int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type patternEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newPatternCache(limit int) *patternCache {
+	return &patternCache{
+		limit:   limit,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *patternCache) get(pattern string) (*regexp.Regexp, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*patternEntry).re, true
+}
+
+func (c *patternCache) put(pattern string, re *regexp.Regexp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[pattern]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[pattern] = c.order.PushFront(&patternEntry{pattern: pattern, re: re})
+	for c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*patternEntry).pattern)
+	}
+}
+
+func (c *patternCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Request — признаки посетителя, по которым проверяются условия правил.
+type Request struct {
+	UserAgent string
+	Languages []string
+	Country   string
+	Time      time.Time
+}
+
+func NewRequest(r *http.Request, country string) Request {
+	return Request{
+		UserAgent: r.UserAgent(),
+		Languages: parseAcceptLanguage(r.Header.Get("Accept-Language")),
+		Country:   country,
+		Time:      time.Now(),
+	}
+}
+
+// parseAcceptLanguage возвращает языки в порядке, указанном клиентом,
+// без "*" и языков с q=0.
+func parseAcceptLanguage(header string) []string {
+	var languages []string
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok && strings.Trim(q, "0.") == "" {
+			continue
+		}
+		languages = append(languages, tag)
+	}
+	return languages
+}
+
+// DetectOS определяет операционную систему по User-Agent. Порядок проверок
+// важен: Android и ChromeOS упоминают Linux, а iPadOS представляется macOS.
+func DetectOS(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return OSiOS
+	case strings.Contains(ua, "android"):
+		return OSAndroid
+	case strings.Contains(ua, "cros"):
+		return OSChromeOS
+	case strings.Contains(ua, "windows"):
+		return OSWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return OSMacOS
+	case strings.Contains(ua, "linux"):
+		return OSLinux
+	}
+	return OSOther
+}
+
+// Match возвращает адрес первого правила, все условия которого выполнены.
+func Match(rules []model.Rule, req Request) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	system := DetectOS(req.UserAgent)
+	for _, rule := range rules {
+		if matches(rule, req, system) {
+			return rule.Destination, true
+		}
+	}
+	return "", false
+}
+
+func matches(rule model.Rule, req Request, system string) bool {
+	if rule.UserAgent != "" {
+		re, err := compile(rule.UserAgent)
+		if err != nil || !re.MatchString(req.UserAgent) {
+			return false
+		}
+	}
+	if len(rule.OS) > 0 && !slices.Contains(rule.OS, system) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !matchLanguage(rule.Languages, req.Languages) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !slices.ContainsFunc(rule.Countries, func(c string) bool {
+		return strings.EqualFold(c, req.Country)
+	}) {
+		return false
+	}
+	if rule.Time != nil && !inWindow(*rule.Time, req.Time) {
+		return false
+	}
+	return true
+}
+
+// matchLanguage сравнивает только самый предпочтительный язык посетителя:
+// "en" совпадает с "en-US", а "en-us" — только с "en-US".
+func matchLanguage(want, have []string) bool {
+	if len(have) == 0 {
+		return false
+	}
+	preferred := have[0]
+	primary, _, _ := strings.Cut(preferred, "-")
+	for _, lang := range want {
+		lang = strings.ToLower(lang)
+		if lang == preferred || lang == primary {
+			return true
+		}
+	}
+	return false
+}
+
+func inWindow(window model.TimeWindow, now time.Time) bool {
+	loc := time.UTC
+	if window.Timezone != "" {
+		l, err := time.LoadLocation(window.Timezone)
+		if err != nil {
+			return false
+		}
+		loc = l
+	}
+	now = now.In(loc)
+
+	if len(window.Days) > 0 && !slices.ContainsFunc(window.Days, func(day string) bool {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		return ok && weekday == now.Weekday()
+	}) {
+		return false
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	from, to := 0, 24*60
+	if window.From != "" {
+		from = clockMinutes(window.From)
+	}
+	if window.To != "" {
+		to = clockMinutes(window.To)
+	}
+
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+func clockMinutes(clock string) int {
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("pattern longer than %d bytes", maxPatternLength)
+	}
+	if re, ok := patterns.get(pattern); ok {
+		return re, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.put(pattern, re)
+	return re, nil
+}
+
+// Validate проверяет условия правила. Адрес назначения проверяет сервис тем
+// же валидатором, что и основной URL ссылки.
+func Validate(rule model.Rule) error {
+	if rule.UserAgent == "" && len(rule.OS) == 0 && len(rule.Languages) == 0 &&
+		len(rule.Countries) == 0 && rule.Time == nil {
+		return fmt.Errorf("%w: rule must have at least one condition", ErrorInvalidRule)
+	}
+	if rule.UserAgent != "" {
+		if _, err := compile(rule.UserAgent); err != nil {
+			return fmt.Errorf("%w: user_agent: %v", ErrorInvalidRule, err)
+		}
+	}
+	for _, system := range rule.OS {
+		if !slices.Contains(knownOS, system) {
+			return fmt.Errorf("%w: unknown os %q, expected one of %s", ErrorInvalidRule, system, strings.Join(knownOS, ", "))
+		}
+	}
+	for _, lang := range rule.Languages {
+		if lang == "" || strings.ContainsAny(lang, ",; ") {
+			return fmt.Errorf("%w: invalid language %q", ErrorInvalidRule, lang)
+		}
+	}
+	for _, country := range rule.Countries {
+		if len(country) != 2 {
+			return fmt.Errorf("%w: country %q must be an ISO 3166-1 alpha-2 code", ErrorInvalidRule, country)
+		}
+	}
+	if rule.Time != nil {
+		return validateWindow(*rule.Time)
+	}
+	return nil
+}
+
+func validateWindow(window model.TimeWindow) error {
+	for _, clock := range []string{window.From, window.To} {
+		if clock == "" {
+			continue
+		}
+		if _, err := time.Parse(clockLayout, clock); err != nil {
+			return fmt.Errorf("%w: time %q must be HH:MM", ErrorInvalidRule, clock)
+		}
+	}
+	for _, day := range window.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("%w: unknown day %q", ErrorInvalidRule, day)
+		}
+	}
+	if window.Timezone != "" {
+		if _, err := time.LoadLocation(window.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrorInvalidRule, window.Timezone)
+		}
+	}
+	return nil
+}
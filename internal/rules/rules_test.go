@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+)
+
+func TestDetectOS(t *testing.T) {
+	assert.Equal(t, OSiOS, DetectOS(iPhoneUA))
+	assert.Equal(t, OSAndroid, DetectOS(androidUA))
+	assert.Equal(t, OSWindows, DetectOS(desktopUA))
+	assert.Equal(t, OSMacOS, DetectOS("Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)"))
+	assert.Equal(t, OSChromeOS, DetectOS("Mozilla/5.0 (X11; CrOS x86_64 15633.69.0)"))
+	assert.Equal(t, OSLinux, DetectOS("Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"))
+	assert.Equal(t, OSOther, DetectOS("curl/8.4.0"))
+}
+
+func TestMatch(t *testing.T) {
+	rules := []model.Rule{
+		{Destination: "https://ru.example/", Countries: []string{"ru", "BY"}},
+		{Destination: "https://apps.apple.com/app", OS: []string{OSiOS}},
+		{Destination: "https://play.google.com/app", OS: []string{OSAndroid}},
+		{Destination: "https://de.example/", Languages: []string{"de"}},
+		{Destination: "https://bot.example/", UserAgent: `bot|crawler`},
+	}
+
+	type testCase struct {
+		name string
+		req  Request
+		want string
+	}
+
+	tests := []testCase{
+		{name: "iOS", req: Request{UserAgent: iPhoneUA}, want: "https://apps.apple.com/app"},
+		{name: "Android", req: Request{UserAgent: androidUA}, want: "https://play.google.com/app"},
+		{name: "Страна важнее ОС", req: Request{UserAgent: iPhoneUA, Country: "RU"}, want: "https://ru.example/"},
+		{name: "Язык по основному тегу", req: Request{UserAgent: desktopUA, Languages: []string{"de-at", "en"}}, want: "https://de.example/"},
+		{name: "Только предпочтительный язык", req: Request{UserAgent: desktopUA, Languages: []string{"en", "de"}}},
+		{name: "Регулярное выражение без учёта регистра", req: Request{UserAgent: "Googlebot/2.1"}, want: "https://bot.example/"},
+		{name: "Ничего не подошло", req: Request{UserAgent: desktopUA}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := Match(rules, test.req)
+			assert.Equal(t, test.want != "", ok)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	night := model.Rule{Destination: "https://night.example/", Time: &model.TimeWindow{
+		From: "22:00", To: "06:00", Timezone: "Europe/Moscow",
+	}}
+	weekend := model.Rule{Destination: "https://weekend.example/", Time: &model.TimeWindow{Days: []string{"sat", "Sun"}}}
+
+	// 2025-03-01 — суббота.
+	saturdayNoonUTC := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mondayLateUTC := time.Date(2025, 3, 3, 20, 30, 0, 0, time.UTC) // 23:30 по Москве
+
+	_, ok := Match([]model.Rule{night}, Request{Time: saturdayNoonUTC})
+	assert.False(t, ok)
+	_, ok = Match([]model.Rule{night}, Request{Time: mondayLateUTC})
+	assert.True(t, ok, "интервал через полночь")
+
+	_, ok = Match([]model.Rule{weekend}, Request{Time: saturdayNoonUTC})
+	assert.True(t, ok)
+	_, ok = Match([]model.Rule{weekend}, Request{Time: mondayLateUTC})
+	assert.False(t, ok)
+}
+
+func TestNewRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/id", nil)
+	r.Header.Set("User-Agent", androidUA)
+	r.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, *;q=0.5, de;q=0")
+
+	req := NewRequest(r, "CH")
+	assert.Equal(t, []string{"fr-ch", "fr"}, req.Languages)
+	assert.Equal(t, "CH", req.Country)
+	assert.Equal(t, androidUA, req.UserAgent)
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []model.Rule{
+		{Destination: "https://a.example/"},
+		{Destination: "https://a.example/", UserAgent: "("},
+		{Destination: "https://a.example/", UserAgent: strings.Repeat("a", maxPatternLength+1)},
+		{Destination: "https://a.example/", OS: []string{"symbian"}},
+		{Destination: "https://a.example/", Countries: []string{"RUS"}},
+		{Destination: "https://a.example/", Time: &model.TimeWindow{From: "25:00"}},
+		{Destination: "https://a.example/", Time: &model.TimeWindow{Days: []string{"funday"}}},
+		{Destination: "https://a.example/", Time: &model.TimeWindow{From: "09:00", Timezone: "Mars/Olympus"}},
+	}
+	for _, rule := range invalid {
+		assert.ErrorIs(t, Validate(rule), ErrorInvalidRule)
+	}
+
+	assert.NoError(t, Validate(model.Rule{Destination: "https://a.example/", OS: []string{OSiOS},
+		Time: &model.TimeWindow{From: "09:00", To: "18:00", Days: []string{"mon"}, Timezone: "Europe/Berlin"}}))
+}
+
+func TestPatternCacheBounded(t *testing.T) {
+	cache := newPatternCache(2)
+	for i := range 3 {
+		cache.put(fmt.Sprintf("p%d", i), nil)
+	}
+	assert.Equal(t, 2, cache.len())
+
+	_, ok := cache.get("p0")
+	assert.False(t, ok, "самый давний шаблон вытесняется")
+	_, ok = cache.get("p2")
+	assert.True(t, ok)
+}
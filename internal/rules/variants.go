@@ -0,0 +1,36 @@
+package rules
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"hash/fnv"
+)
+
+// PickVariant выбирает вариант по весам детерминированно для key: один и тот
+// же посетитель попадает на один и тот же вариант, пока не изменились веса.
+// Варианты с нулевым весом не выбираются.
+func PickVariant(key string, variants []model.Variant) (model.Variant, bool) {
+	var total uint64
+	for _, v := range variants {
+		if v.Weight > 0 {
+			total += uint64(v.Weight)
+		}
+	}
+	if total == 0 {
+		return model.Variant{}, false
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	point := h.Sum64() % total
+
+	for _, v := range variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		if point < uint64(v.Weight) {
+			return v, true
+		}
+		point -= uint64(v.Weight)
+	}
+	return model.Variant{}, false
+}
@@ -0,0 +1,34 @@
+package rules
+
+import (
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPickVariant(t *testing.T) {
+	variants := []model.Variant{
+		{ID: "a", Destination: "https://a.example/", Weight: 3},
+		{ID: "paused", Destination: "https://paused.example/", Weight: 0},
+		{ID: "b", Destination: "https://b.example/", Weight: 1},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("visitor-%d|linkID", i)
+		v, ok := PickVariant(key, variants)
+		assert.True(t, ok)
+		counts[v.ID]++
+
+		again, _ := PickVariant(key, variants)
+		assert.Equal(t, v.ID, again.ID, "назначение стабильно")
+	}
+
+	assert.Zero(t, counts["paused"])
+	assert.InDelta(t, 3000, counts["a"], 200)
+	assert.InDelta(t, 1000, counts["b"], 200)
+
+	_, ok := PickVariant("visitor", []model.Variant{{ID: "a", Weight: 0}})
+	assert.False(t, ok)
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Методы ниже предназначены для внутреннего API и не проверяют владельца:
+// доступ к ним ограничивается на уровне маршрутов.
+
+func (ss *ShortenerService) Totals(ctx context.Context) (repository.Totals, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.Totals")
+	defer span.End()
+
+	totals, err := ss.repo.Totals(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return repository.Totals{}, err
+	}
+	return totals, nil
+}
+
+// LookupLink возвращает ссылку в любом состоянии, в том числе удалённую.
+func (ss *ShortenerService) LookupLink(ctx context.Context, id string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.LookupLink")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.repo.Get(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+	return link, nil
+}
+
+// SetLinkDisabled принудительно отключает или включает ссылку. Пустая
+// причина отключения заменяется на model.DisabledByAdmin; при включении
+// причина сбрасывается.
+func (ss *ShortenerService) SetLinkDisabled(ctx context.Context, id string, disabled bool, reason string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.SetLinkDisabled")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id), attribute.Bool("shortener.disabled", disabled))
+
+	link, err := ss.repo.Get(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+
+	switch {
+	case !disabled:
+		reason = ""
+	case reason == "":
+		reason = model.DisabledByAdmin
+	case len(reason) > 256:
+		return model.URLModel{}, invalidOption("reason", "must not exceed 256 bytes")
+	}
+
+	if err := ss.repo.SetDisabled(ctx, id, disabled, reason); err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+	link.Disabled = disabled
+	link.DisabledReason = reason
+
+	logger.FromContext(ctx).Info("Ссылка переключена администратором",
+		zap.String("id", id), zap.Bool("disabled", disabled), zap.String("reason", reason))
+	return link, nil
+}
+
+// DeleteUserLinks помечает удалёнными все ссылки пользователя userID.
+func (ss *ShortenerService) DeleteUserLinks(ctx context.Context, userID string) (int64, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.DeleteUserLinks")
+	defer span.End()
+
+	if userID == "" {
+		return 0, invalidOption("user_id", "is required")
+	}
+
+	deleted, err := ss.repo.DeleteUserLinks(ctx, userID, time.Now().UTC())
+	if err != nil {
+		span.RecordError(err)
+		return deleted, err
+	}
+
+	logger.FromContext(ctx).Info("Ссылки пользователя удалены", zap.String("user_id", userID), zap.Int64("deleted", deleted))
+	return deleted, nil
+}
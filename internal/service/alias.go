@@ -0,0 +1,28 @@
+package service
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Длина псевдонима ограничена размером short_id в DB.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,10}$`)
+
+// reservedAliases совпадают с путями самого сервиса.
+var reservedAliases = []string{"api", "dashboard", "metrics", "ping"}
+
+// checkAlias проверяет желаемый идентификатор ссылки. Пустой псевдоним
+// означает случайный идентификатор.
+func checkAlias(alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if !aliasPattern.MatchString(alias) {
+		return invalidOption("alias", "must be 3-10 letters, digits, '-' or '_'")
+	}
+	if slices.Contains(reservedAliases, strings.ToLower(alias)) {
+		return invalidOption("alias", "%q is reserved", alias)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"slices"
+	"time"
+)
+
+const maxAPIKeyNameLen = 64
+
+// CreateAPIKey выпускает ключ пользователю userID. Ключ возвращается только
+// здесь: в хранилище попадает лишь хеш его секрета.
+func (ss *ShortenerService) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (model.APIKey, string, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.CreateAPIKey")
+	defer span.End()
+
+	if userID == "" {
+		return model.APIKey{}, "", ErrorForbidden
+	}
+	if len(name) > maxAPIKeyNameLen {
+		return model.APIKey{}, "", invalidOption("name", "must not exceed %d bytes", maxAPIKeyNameLen)
+	}
+	if len(scopes) == 0 {
+		return model.APIKey{}, "", invalidOption("scopes", "at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return model.APIKey{}, "", invalidOption("scopes", "unknown scope %q", scope)
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return model.APIKey{}, "", invalidOption("expires_at", "must be in the future")
+	}
+
+	id, token, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	span.SetAttributes(attribute.String("shortener.api_key_id", id))
+
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	key := model.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash,
+		Scopes:    slices.Compact(scopes),
+		CreatedAt: now,
+		ExpiresAt: utcTime(expiresAt),
+	}
+	if err := ss.repo.SaveAPIKey(ctx, key); err != nil {
+		span.RecordError(err)
+		return model.APIKey{}, "", err
+	}
+
+	logger.FromContext(ctx).Info("Выпущен API-ключ", zap.String("key_id", id), zap.Strings("scopes", key.Scopes))
+	return key, token, nil
+}
+
+func (ss *ShortenerService) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.ListAPIKeys")
+	defer span.End()
+
+	if userID == "" {
+		return nil, ErrorForbidden
+	}
+	return ss.repo.ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey отзывает ключ id пользователя userID. Чужой ключ неотличим от
+// несуществующего.
+func (ss *ShortenerService) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.RevokeAPIKey")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.api_key_id", id))
+
+	key, err := ss.repo.GetAPIKey(ctx, id)
+	if errors.Is(err, repository.ErrorNotFound) || (err == nil && key.UserID != userID) {
+		return ErrorAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ss.repo.RevokeAPIKey(ctx, id, time.Now().UTC()); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	logger.FromContext(ctx).Info("API-ключ отозван", zap.String("key_id", id))
+	return nil
+}
+
+// AuthenticateAPIKey возвращает запись ключа token, если он действителен.
+func (ss *ShortenerService) AuthenticateAPIKey(ctx context.Context, token string) (model.APIKey, error) {
+	id, secret, ok := auth.ParseAPIKey(token)
+	if !ok {
+		return model.APIKey{}, ErrorInvalidAPIKey
+	}
+
+	key, err := ss.repo.GetAPIKey(ctx, id)
+	if errors.Is(err, repository.ErrorNotFound) {
+		return model.APIKey{}, ErrorInvalidAPIKey
+	}
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	if !auth.SecretMatches(secret, key.Hash) || !key.Usable(time.Now()) {
+		return model.APIKey{}, ErrorInvalidAPIKey
+	}
+	return key, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrorInvalidURL = errors.New("invalid URL")
+	ErrorBlockedURL = errors.New("URL is blocked")
+
+	ErrorInvalidOptions = errors.New("invalid link options")
+
+	ErrorInvalidPassword = errors.New("invalid password")
+	ErrorWrongPassword   = errors.New("wrong password")
+
+	ErrorForbidden = errors.New("link belongs to another user")
+
+	ErrorInvalidAPIKey  = errors.New("invalid API key")
+	ErrorAPIKeyNotFound = errors.New("API key not found")
+
+	ErrorTagNotFound = errors.New("tag not found")
+)
+
+// ValidationError поясняет ошибку проверки входных данных (ErrorInvalidURL,
+// ErrorInvalidOptions и т. п.): какое поле запроса её вызвало и почему.
+// Field и Message предназначены клиенту, поэтому во Message не попадают
+// внутренние причины. Field пуст, если ошибка относится к самому адресу.
+type ValidationError struct {
+	Err     error
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v: %s", e.Err, e.Message)
+	}
+	return fmt.Sprintf("%v: %s: %s", e.Err, e.Field, e.Message)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func invalidOption(field, format string, args ...any) error {
+	return &ValidationError{Err: ErrorInvalidOptions, Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// inField относит ошибку проверки вложенного адреса к полю field
+// ("fallback_url", "rules[1].destination"). Остальные ошибки возвращаются
+// как есть.
+func inField(err error, field string) error {
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		return err
+	}
+
+	nested := *validation
+	if nested.Field == "" {
+		nested.Field = field
+	} else {
+		nested.Field = field + "." + nested.Field
+	}
+	return &nested
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"strings"
+	"time"
+)
+
+// ListOptions задаёт отбор, порядок и страницу для ListLinks. Пустые поля
+// выборку не ограничивают, Limit = 0 отдаёт все ссылки.
+type ListOptions struct {
+	State  string
+	Tag    string
+	Domain string
+	// Search — подстрока идентификатора или адреса назначения, регистр
+	// не учитывается.
+	Search string
+
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	// Sort — repository.SortCreated (по умолчанию) или repository.SortClicks,
+	// Order — "desc" (по умолчанию) или "asc".
+	Sort   string
+	Order  string
+	Cursor string
+	Limit  int
+}
+
+// LinkPage — страница выдачи ListLinks. NextCursor пуст на последней странице.
+type LinkPage struct {
+	Links      []model.URLModel
+	NextCursor string
+}
+
+const (
+	OrderDesc = "desc"
+	OrderAsc  = "asc"
+)
+
+// listCursor — содержимое курсора. Порядок сохраняется в нём, чтобы курсор
+// нельзя было применить к выдаче с другой сортировкой.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   int64  `json:"k"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil || cursor.ID == "" {
+		return listCursor{}, invalidOption("cursor", "is malformed")
+	}
+	return cursor, nil
+}
+
+// ListLinks возвращает страницу ссылок пользователя userID. Непустой
+// opts.State оставляет только ссылки в этом состоянии (см.
+// model.URLModel.State); удалённые ссылки отдаются только при state=deleted.
+func (ss *ShortenerService) ListLinks(ctx context.Context, userID string, opts ListOptions) (LinkPage, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.ListLinks")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.state", opts.State), attribute.String("shortener.sort", opts.Sort))
+
+	if userID == "" {
+		return LinkPage{}, ErrorForbidden
+	}
+
+	filter, err := listFilter(opts)
+	if err != nil {
+		return LinkPage{}, err
+	}
+	filter.UserID = userID
+
+	// Лишняя ссылка показывает, что за страницей есть продолжение.
+	if opts.Limit > 0 {
+		filter.Limit = opts.Limit + 1
+	}
+	links, err := ss.repo.List(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return LinkPage{}, err
+	}
+
+	page := LinkPage{Links: links}
+	if opts.Limit > 0 && len(links) > opts.Limit {
+		order := OrderDesc
+		if filter.Ascending {
+			order = OrderAsc
+		}
+		page.Links = links[:opts.Limit]
+		last := page.Links[len(page.Links)-1]
+		page.NextCursor = encodeCursor(listCursor{
+			Sort:  filter.Sort,
+			Order: order,
+			Key:   repository.SortKey(last, filter.Sort),
+			ID:    last.ShortURL,
+		})
+	}
+	return page, nil
+}
+
+// listFilter проверяет opts и переводит их в фильтр хранилища.
+func listFilter(opts ListOptions) (repository.ListFilter, error) {
+	if opts.State != "" && !model.ValidState(opts.State) {
+		return repository.ListFilter{}, invalidOption("state", "must be one of %s, %s, %s, %s",
+			model.StateScheduled, model.StateActive, model.StateExpired, model.StateDeleted)
+	}
+	if opts.Sort == "" {
+		opts.Sort = repository.SortCreated
+	}
+	if !repository.ValidSort(opts.Sort) {
+		return repository.ListFilter{}, invalidOption("sort", "must be %s or %s",
+			repository.SortCreated, repository.SortClicks)
+	}
+	if opts.Order == "" {
+		opts.Order = OrderDesc
+	}
+	if opts.Order != OrderDesc && opts.Order != OrderAsc {
+		return repository.ListFilter{}, invalidOption("order", "must be %s or %s", OrderDesc, OrderAsc)
+	}
+	if opts.Limit < 0 {
+		return repository.ListFilter{}, invalidOption("limit", "must not be negative")
+	}
+	if opts.CreatedFrom != nil && opts.CreatedTo != nil && !opts.CreatedFrom.Before(*opts.CreatedTo) {
+		return repository.ListFilter{}, invalidOption("created_to", "must be later than created_from")
+	}
+
+	filter := repository.ListFilter{
+		State:       opts.State,
+		Now:         time.Now(),
+		Domain:      strings.TrimSuffix(strings.ToLower(strings.TrimSpace(opts.Domain)), "."),
+		Search:      strings.ToLower(strings.TrimSpace(opts.Search)),
+		CreatedFrom: opts.CreatedFrom,
+		CreatedTo:   opts.CreatedTo,
+		Sort:        opts.Sort,
+		Ascending:   opts.Order == OrderAsc,
+	}
+
+	if opts.Tag != "" {
+		tag, err := normalizeTag(opts.Tag)
+		if err != nil {
+			return repository.ListFilter{}, err
+		}
+		filter.Tag = tag
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return repository.ListFilter{}, err
+		}
+		if cursor.Sort != opts.Sort || cursor.Order != opts.Order {
+			return repository.ListFilter{}, invalidOption("cursor", "belongs to a listing with another sort order")
+		}
+		filter.After = &repository.Cursor{Key: cursor.Key, ID: cursor.ID}
+	}
+	return filter, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const maxPasswordLength = 72
+
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+
+	if len(password) > maxPasswordLength {
+		return "", &ValidationError{
+			Err:     ErrorInvalidPassword,
+			Field:   "password",
+			Message: fmt.Sprintf("must not be longer than %d bytes", maxPasswordLength),
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPassword(hash, password string) error {
+	if hash == "" {
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrorWrongPassword
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+)
+
+// Значения шаблонов могут содержать подстановки {id}, {variant} и {country},
+// которые раскрываются при переходе.
+var queryParamLimits = mapLimits{entries: 20, keyLen: 64, valueLen: 512}
+
+// checkQuery проверяет шаблоны параметров запроса и политику конфликтов.
+func checkQuery(params map[string]string, conflict string) (map[string]string, error) {
+	if conflict != "" && !model.ValidQueryConflict(conflict) {
+		return nil, invalidOption("query_conflict", "unknown value %q", conflict)
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+
+	patch := make(map[string]*string, len(params))
+	for key, value := range params {
+		patch[key] = &value
+	}
+	return mergeStrings("query_params", nil, patch, make(map[string]model.FieldChange), queryParamLimits)
+}
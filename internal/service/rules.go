@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/rules"
+	"strings"
+)
+
+const maxRules = 20
+
+// checkRules проверяет правила маршрутизации и приводит их к каноническому
+// виду: адреса нормализуются, коды стран — в верхнем регистре, ОС и языки — в
+// нижнем. Пустой список возвращается как nil.
+func (ss *ShortenerService) checkRules(ctx context.Context, routing []model.Rule) ([]model.Rule, error) {
+	if len(routing) == 0 {
+		return nil, nil
+	}
+	if len(routing) > maxRules {
+		return nil, invalidOption("rules", "at most %d rules are allowed", maxRules)
+	}
+
+	checked := make([]model.Rule, 0, len(routing))
+	for i, rule := range routing {
+		rule.OS = mapStrings(rule.OS, strings.ToLower)
+		rule.Languages = mapStrings(rule.Languages, strings.ToLower)
+		rule.Countries = mapStrings(rule.Countries, strings.ToUpper)
+
+		if err := rules.Validate(rule); err != nil {
+			return nil, invalidOption(fmt.Sprintf("rules[%d]", i), "%v", err)
+		}
+
+		destination, err := ss.checkDestination(ctx, rule.Destination)
+		if err != nil {
+			return nil, inField(err, fmt.Sprintf("rules[%d].destination", i))
+		}
+		rule.Destination = destination
+		checked = append(checked, rule)
+	}
+
+	return checked, nil
+}
+
+func mapStrings(values []string, fn func(string) string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	mapped := make([]string, len(values))
+	for i, v := range values {
+		mapped[i] = fn(v)
+	}
+	return mapped
+}
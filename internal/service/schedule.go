@@ -0,0 +1,11 @@
+package service
+
+import "time"
+
+// checkWindow проверяет, что окно активности не пустое.
+func checkWindow(activeFrom, activeUntil *time.Time) error {
+	if activeFrom != nil && activeUntil != nil && !activeFrom.Before(*activeUntil) {
+		return invalidOption("active_until", "must be later than active_from")
+	}
+	return nil
+}
@@ -3,45 +3,350 @@ package service
 import (
 	"context"
 	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/metrics"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
 	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+	"time"
 )
 
+const tracerName = "github.com/Guram-Gurych/shortenerURL.git/internal/service"
+
+type CreateOptions struct {
+	UserID       string
+	Alias        string
+	ExpiresAt    *time.Time
+	Password     string
+	MaxClicks    int64
+	Interstitial bool
+	RedirectType string
+	Rules        []model.Rule
+	Variants     []model.Variant
+
+	QueryParams   map[string]string
+	QueryConflict string
+	ForwardQuery  bool
+
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+	FallbackURL string
+
+	Tags []string
+}
+
 type URLShortener interface {
-	CreateShortURL(ctx context.Context, originalURL string) (string, error)
-	GetOriginalURL(ctx context.Context, id string) (string, error)
+	CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error)
+	GetLink(ctx context.Context, id string) (model.URLModel, error)
+	UnlockLink(ctx context.Context, id, password string) (model.URLModel, error)
+	RegisterClick(ctx context.Context, id, variant string) (model.URLModel, error)
+	UpdateLink(ctx context.Context, id, userID string, version int64, patch LinkPatch) (model.URLModel, error)
+	LinkHistory(ctx context.Context, id, userID string) ([]model.HistoryEntry, error)
+	LinkStats(ctx context.Context, id, userID string) (model.URLModel, error)
+	DeleteLink(ctx context.Context, id, userID string) error
+	ListLinks(ctx context.Context, userID string, opts ListOptions) (LinkPage, error)
+
+	AddTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error)
+	RemoveTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error)
+	ListTags(ctx context.Context, userID string) ([]repository.TagStats, error)
+	TagStats(ctx context.Context, userID, tag string) (repository.TagStats, error)
+
+	CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (model.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	AuthenticateAPIKey(ctx context.Context, token string) (model.APIKey, error)
+
+	Totals(ctx context.Context) (repository.Totals, error)
+	LookupLink(ctx context.Context, id string) (model.URLModel, error)
+	SetLinkDisabled(ctx context.Context, id string, disabled bool, reason string) (model.URLModel, error)
+	DeleteUserLinks(ctx context.Context, userID string) (int64, error)
+}
+
+type URLScreener interface {
+	Match(rawURL string) (string, bool)
 }
 
 type ShortenerService struct {
-	repo repository.URLRepository
+	repo      repository.URLRepository
+	validator *URLValidator
+	screener  URLScreener
 }
 
-func NewShortenerService(repo repository.URLRepository) *ShortenerService {
-	return &ShortenerService{
-		repo: repo,
+type Option func(*ShortenerService)
+
+func WithURLValidator(v *URLValidator) Option {
+	return func(ss *ShortenerService) {
+		ss.validator = v
+	}
+}
+
+func WithScreener(screener URLScreener) Option {
+	return func(ss *ShortenerService) {
+		ss.screener = screener
+	}
+}
+
+func NewShortenerService(repo repository.URLRepository, opts ...Option) *ShortenerService {
+	ss := &ShortenerService{
+		repo:      repo,
+		validator: DefaultURLValidator(),
+	}
+
+	for _, opt := range opts {
+		opt(ss)
+	}
+	return ss
+}
+
+// checkDestination нормализует адрес назначения и проверяет его по блок-листу.
+func (ss *ShortenerService) checkDestination(ctx context.Context, rawURL string) (string, error) {
+	normalized, err := ss.validator.Normalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if ss.screener != nil {
+		if rule, blocked := ss.screener.Match(normalized); blocked {
+			logger.FromContext(ctx).Warn("Отклонён URL из блок-листа", zap.String("url", normalized), zap.String("rule", rule))
+			return "", &ValidationError{Err: ErrorBlockedURL, Message: fmt.Sprintf("host matches blocklist rule %q", rule)}
+		}
 	}
+
+	return normalized, nil
 }
 
 func generateID() string {
 	return uuid.New().String()[:8]
 }
 
-func (ss *ShortenerService) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
+func (ss *ShortenerService) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (string, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.CreateShortURL")
+	defer span.End()
+
+	originalURL, err := ss.checkDestination(ctx, originalURL)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkAlias(opts.Alias); err != nil {
+		return "", err
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return "", invalidOption("expires_at", "must be in the future")
+	}
+	if opts.MaxClicks < 0 {
+		return "", invalidOption("max_clicks", "must not be negative")
+	}
+	if opts.RedirectType != "" && !model.ValidRedirectType(opts.RedirectType) {
+		return "", invalidOption("redirect_type", "unknown value %q", opts.RedirectType)
+	}
+
+	routing, err := ss.checkRules(ctx, opts.Rules)
+	if err != nil {
+		return "", err
+	}
+
+	variants, err := ss.checkVariants(ctx, opts.Variants)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams, err := checkQuery(opts.QueryParams, opts.QueryConflict)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkWindow(opts.ActiveFrom, opts.ActiveUntil); err != nil {
+		return "", err
+	}
+	var fallbackURL string
+	if opts.FallbackURL != "" {
+		fallbackURL, err = ss.checkDestination(ctx, opts.FallbackURL)
+		if err != nil {
+			return "", inField(err, "fallback_url")
+		}
+	}
+
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) > 0 && opts.UserID == "" {
+		return "", invalidOption("tags", "require a signed-in user")
+	}
+
+	passwordHash, err := hashPassword(opts.Password)
+	if err != nil {
+		return "", err
+	}
+
 	id := generateID()
+	if opts.Alias != "" {
+		id = opts.Alias
+	}
+	span.SetAttributes(attribute.String("shortener.id", id))
 
-	if err := ss.repo.Save(ctx, id, originalURL); err != nil {
+	link := model.URLModel{
+		ShortURL:     id,
+		OriginalURL:  originalURL,
+		UserID:       opts.UserID,
+		Version:      1,
+		CreatedAt:    time.Now().UTC(),
+		ExpiresAt:    utcTime(opts.ExpiresAt),
+		PasswordHash: passwordHash,
+		MaxClicks:    opts.MaxClicks,
+		Interstitial: opts.Interstitial,
+		RedirectType: opts.RedirectType,
+		Rules:        routing,
+		Variants:     variants,
+
+		QueryParams:   queryParams,
+		QueryConflict: opts.QueryConflict,
+		ForwardQuery:  opts.ForwardQuery,
+
+		ActiveFrom:  utcTime(opts.ActiveFrom),
+		ActiveUntil: utcTime(opts.ActiveUntil),
+		FallbackURL: fallbackURL,
+	}
+	if len(tags) > 0 {
+		link.Tags = tags
+	}
+	if err := ss.repo.Save(ctx, link); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "save failed")
+		logger.FromContext(ctx).Warn("Не удалось сохранить URL", zap.String("id", id), zap.Error(err))
 		return "", fmt.Errorf("не удалось сохранить URL в сервисе: %w", err)
 	}
 
+	metrics.LinksCreatedTotal.Inc()
+	logger.FromContext(ctx).Debug("Создана короткая ссылка", zap.String("id", id))
 	return id, nil
 }
 
-func (ss *ShortenerService) GetOriginalURL(ctx context.Context, id string) (string, error) {
-	value, err := ss.repo.Get(ctx, id)
+func (ss *ShortenerService) GetLink(ctx context.Context, id string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.GetLink")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.repo.Get(ctx, id)
 
 	if err != nil {
-		return "", err
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+	if link.Deleted() {
+		return model.URLModel{}, repository.ErrorGone
 	}
 
-	return value, nil
+	return link, nil
+}
+
+func (ss *ShortenerService) RegisterClick(ctx context.Context, id, variant string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.RegisterClick")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.repo.Hit(ctx, id, variant)
+	if err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+
+	return link, nil
+}
+
+func (ss *ShortenerService) UnlockLink(ctx context.Context, id, password string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.UnlockLink")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.repo.Get(ctx, id)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	if link.Deleted() {
+		return model.URLModel{}, repository.ErrorGone
+	}
+
+	if err := checkPassword(link.PasswordHash, password); err != nil {
+		logger.FromContext(ctx).Info("Неверный пароль для ссылки", zap.String("id", id))
+		return model.URLModel{}, err
+	}
+
+	return link, nil
+}
+
+// ApplyBlocklist отключает сохранённые ссылки, попавшие в блок-лист, и
+// включает обратно те, что были отключены им ранее, но больше не совпадают.
+func (ss *ShortenerService) ApplyBlocklist(ctx context.Context) (int, int, error) {
+	if ss.screener == nil {
+		return 0, 0, nil
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.ApplyBlocklist")
+	defer span.End()
+
+	var toDisable, toEnable []string
+	err := ss.repo.ForEach(ctx, func(link model.URLModel) error {
+		blocked := ss.blocked(link)
+		switch {
+		case blocked && !link.Disabled:
+			toDisable = append(toDisable, link.ShortURL)
+		case !blocked && link.Disabled && link.DisabledReason == model.DisabledByBlocklist:
+			toEnable = append(toEnable, link.ShortURL)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, 0, err
+	}
+
+	for _, id := range toDisable {
+		if err := ss.repo.SetDisabled(ctx, id, true, model.DisabledByBlocklist); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, id := range toEnable {
+		if err := ss.repo.SetDisabled(ctx, id, false, ""); err != nil {
+			return len(toDisable), 0, err
+		}
+	}
+
+	return len(toDisable), len(toEnable), nil
+}
+
+// blocked сообщает, попадает ли в блок-лист хотя бы один из адресов ссылки.
+func (ss *ShortenerService) blocked(link model.URLModel) bool {
+	if _, blocked := ss.screener.Match(link.OriginalURL); blocked {
+		return true
+	}
+	for _, rule := range link.Rules {
+		if _, blocked := ss.screener.Match(rule.Destination); blocked {
+			return true
+		}
+	}
+	for _, v := range link.Variants {
+		if _, blocked := ss.screener.Match(v.Destination); blocked {
+			return true
+		}
+	}
+	if link.FallbackURL != "" {
+		if _, blocked := ss.screener.Match(link.FallbackURL); blocked {
+			return true
+		}
+	}
+	return false
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
 }
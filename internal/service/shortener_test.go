@@ -0,0 +1,813 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/auth"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type hostScreener map[string]bool
+
+func (s hostScreener) Match(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return u.Hostname(), s[u.Hostname()]
+}
+
+func TestCreateShortURLBlocked(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	ss := NewShortenerService(repo, WithScreener(hostScreener{"evil.example": true}))
+
+	_, err := ss.CreateShortURL(context.Background(), "https://evil.example/login", CreateOptions{})
+	assert.ErrorIs(t, err, ErrorBlockedURL)
+
+	id, err := ss.CreateShortURL(context.Background(), "https://good.example/", CreateOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+}
+
+func TestApplyBlocklist(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.Save(ctx, model.URLModel{ShortURL: "bad", OriginalURL: "https://evil.example/"}))
+	require.NoError(t, repo.Save(ctx, model.URLModel{ShortURL: "good", OriginalURL: "https://good.example/"}))
+	require.NoError(t, repo.Save(ctx, model.URLModel{
+		ShortURL:       "unblocked",
+		OriginalURL:    "https://reformed.example/",
+		Disabled:       true,
+		DisabledReason: model.DisabledByBlocklist,
+	}))
+	require.NoError(t, repo.Save(ctx, model.URLModel{
+		ShortURL:       "manual",
+		OriginalURL:    "https://manual.example/",
+		Disabled:       true,
+		DisabledReason: "admin",
+	}))
+
+	ss := NewShortenerService(repo, WithScreener(hostScreener{"evil.example": true}))
+
+	disabled, enabled, err := ss.ApplyBlocklist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, disabled)
+	assert.Equal(t, 1, enabled)
+
+	expected := map[string]bool{"bad": true, "good": false, "unblocked": false, "manual": true}
+	for id, isDisabled := range expected {
+		link, err := ss.GetLink(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, isDisabled, link.Disabled, id)
+	}
+}
+
+func TestUnlockLink(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	id, err := ss.CreateShortURL(ctx, "https://docs.internal.example/", CreateOptions{Password: "s3cret"})
+	require.NoError(t, err)
+
+	link, err := ss.GetLink(ctx, id)
+	require.NoError(t, err)
+	assert.NotEmpty(t, link.PasswordHash)
+	assert.NotEqual(t, "s3cret", link.PasswordHash)
+
+	_, err = ss.UnlockLink(ctx, id, "wrong")
+	assert.ErrorIs(t, err, ErrorWrongPassword)
+
+	link, err = ss.UnlockLink(ctx, id, "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "https://docs.internal.example/", link.OriginalURL)
+}
+
+func TestRegisterClickMaxClicks(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	_, err := ss.CreateShortURL(ctx, "https://files.example/", CreateOptions{MaxClicks: -1})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	id, err := ss.CreateShortURL(ctx, "https://files.example/", CreateOptions{MaxClicks: 2})
+	require.NoError(t, err)
+
+	for i := 1; i <= 2; i++ {
+		link, err := ss.RegisterClick(ctx, id, "")
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), link.Clicks)
+	}
+
+	_, err = ss.RegisterClick(ctx, id, "")
+	assert.ErrorIs(t, err, repository.ErrorGone)
+}
+
+func TestRegisterClickConcurrent(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	id, err := ss.CreateShortURL(ctx, "https://files.example/", CreateOptions{MaxClicks: 10})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ss.RegisterClick(ctx, id, ""); err == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), succeeded.Load())
+}
+
+func TestUpdateLink(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository(), WithScreener(hostScreener{"evil.example": true}))
+
+	id, err := ss.CreateShortURL(ctx, "https://typo.example/", CreateOptions{UserID: "owner"})
+	require.NoError(t, err)
+
+	fixed := "https://fixed.example/"
+	_, err = ss.UpdateLink(ctx, id, "intruder", 1, LinkPatch{OriginalURL: &fixed})
+	assert.ErrorIs(t, err, ErrorForbidden)
+
+	evil := "https://evil.example/"
+	_, err = ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{OriginalURL: &evil})
+	assert.ErrorIs(t, err, ErrorBlockedURL)
+
+	campaign := "spring"
+	link, err := ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{
+		OriginalURL: &fixed,
+		Metadata:    map[string]*string{"campaign": &campaign},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), link.Version)
+	assert.Equal(t, fixed, link.OriginalURL)
+	assert.Equal(t, map[string]string{"campaign": "spring"}, link.Metadata)
+
+	_, err = ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{OriginalURL: &evil})
+	assert.ErrorIs(t, err, repository.ErrorConflict)
+
+	link, err = ss.UpdateLink(ctx, id, "owner", 2, LinkPatch{OriginalURL: &fixed})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), link.Version, "пустое изменение не меняет версию")
+
+	history, err := ss.LinkHistory(ctx, id, "owner")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, int64(2), history[0].Version)
+	assert.Equal(t, "owner", history[0].ChangedBy)
+	assert.Equal(t, model.FieldChange{Old: "https://typo.example/", New: fixed}, history[0].Changes["original_url"])
+	assert.Contains(t, history[0].Changes, "metadata.campaign")
+
+	_, err = ss.LinkHistory(ctx, id, "intruder")
+	assert.ErrorIs(t, err, ErrorForbidden)
+
+	link, err = ss.LinkStats(ctx, id, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, fixed, link.OriginalURL)
+	_, err = ss.LinkStats(ctx, id, "intruder")
+	assert.ErrorIs(t, err, ErrorForbidden)
+
+	past := time.Now().Add(-time.Hour)
+	_, err = ss.UpdateLink(ctx, id, "owner", 2, LinkPatch{ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrorInvalidOptions, "срок действия должен быть в будущем")
+
+	future := time.Now().Add(time.Hour)
+	link, err = ss.UpdateLink(ctx, id, "owner", AnyVersion, LinkPatch{ExpiresAt: &future})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), link.Version)
+}
+
+func TestRedirectTypeValidation(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	_, err := ss.CreateShortURL(ctx, "https://seo.example/", CreateOptions{RedirectType: "303"})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	id, err := ss.CreateShortURL(ctx, "https://seo.example/", CreateOptions{UserID: "owner", RedirectType: model.RedirectPermanent})
+	require.NoError(t, err)
+
+	js, bogus := model.RedirectJavaScript, "refresh"
+	_, err = ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{RedirectType: &bogus})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	link, err := ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{RedirectType: &js})
+	require.NoError(t, err)
+	assert.Equal(t, model.RedirectJavaScript, link.RedirectType)
+}
+
+func TestRoutingRulesValidation(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	ss := NewShortenerService(repo, WithScreener(hostScreener{"evil.example": true}))
+
+	_, err := ss.CreateShortURL(ctx, "https://app.example/", CreateOptions{
+		Rules: []model.Rule{{Destination: "https://apps.apple.com/app"}},
+	})
+	assert.ErrorIs(t, err, ErrorInvalidOptions, "правило без условий")
+
+	_, err = ss.CreateShortURL(ctx, "https://app.example/", CreateOptions{
+		Rules: []model.Rule{{Destination: "javascript:alert(1)", OS: []string{"ios"}}},
+	})
+	assert.ErrorIs(t, err, ErrorInvalidURL)
+	var validation *ValidationError
+	require.ErrorAs(t, err, &validation)
+	assert.Equal(t, "rules[0].destination", validation.Field)
+
+	_, err = ss.CreateShortURL(ctx, "https://app.example/", CreateOptions{
+		Rules: []model.Rule{{Destination: "https://evil.example/", Countries: []string{"de"}}},
+	})
+	assert.ErrorIs(t, err, ErrorBlockedURL)
+
+	id, err := ss.CreateShortURL(ctx, "https://app.example/", CreateOptions{
+		UserID: "owner",
+		Rules:  []model.Rule{{Destination: " https://Apps.Apple.com/app ", OS: []string{"iOS"}, Countries: []string{"de"}}},
+	})
+	require.NoError(t, err)
+
+	link, err := ss.GetLink(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, link.Rules, 1)
+	assert.Equal(t, "https://apps.apple.com/app", link.Rules[0].Destination)
+	assert.Equal(t, []string{"ios"}, link.Rules[0].OS)
+	assert.Equal(t, []string{"DE"}, link.Rules[0].Countries)
+
+	empty := []model.Rule{}
+	link, err = ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{Rules: &empty})
+	require.NoError(t, err)
+	assert.Nil(t, link.Rules)
+	assert.Equal(t, int64(2), link.Version)
+}
+
+func TestApplyBlocklistChecksRuleDestinations(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.Save(ctx, model.URLModel{
+		ShortURL:    "routed",
+		OriginalURL: "https://good.example/",
+		Rules:       []model.Rule{{Destination: "https://evil.example/", OS: []string{"android"}}},
+	}))
+
+	ss := NewShortenerService(repo, WithScreener(hostScreener{"evil.example": true}))
+	disabled, _, err := ss.ApplyBlocklist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, disabled)
+}
+
+func TestVariants(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository(), WithScreener(hostScreener{"evil.example": true}))
+
+	_, err := ss.CreateShortURL(ctx, "https://landing.example/", CreateOptions{
+		Variants: []model.Variant{{ID: "a", Destination: "https://a.example/"}, {ID: "A", Destination: "https://b.example/"}},
+	})
+	assert.ErrorIs(t, err, ErrorInvalidOptions, "повторяющийся идентификатор")
+
+	_, err = ss.CreateShortURL(ctx, "https://landing.example/", CreateOptions{
+		Variants: []model.Variant{{Destination: "https://a.example/", Weight: -1}},
+	})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	_, err = ss.CreateShortURL(ctx, "https://landing.example/", CreateOptions{
+		Variants: []model.Variant{{Destination: "https://evil.example/", Weight: 1}},
+	})
+	assert.ErrorIs(t, err, ErrorBlockedURL)
+
+	id, err := ss.CreateShortURL(ctx, "https://landing.example/", CreateOptions{
+		UserID: "owner",
+		Variants: []model.Variant{
+			{Destination: "https://a.example/", Weight: 50, Clicks: 100},
+			{ID: "v1", Destination: "https://b.example/", Weight: 50},
+		},
+	})
+	require.NoError(t, err)
+
+	link, err := ss.GetLink(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, link.Variants, 2)
+	assert.Equal(t, "v2", link.Variants[0].ID, "v1 уже занят")
+	assert.Zero(t, link.Variants[0].Clicks)
+
+	for range 3 {
+		_, err = ss.RegisterClick(ctx, id, "v1")
+		require.NoError(t, err)
+	}
+	_, err = ss.RegisterClick(ctx, id, "v2")
+	require.NoError(t, err)
+
+	reweighted := []model.Variant{
+		{ID: "v2", Destination: "https://a.example/", Weight: 90},
+		{ID: "v1", Destination: "https://b.example/", Weight: 10},
+	}
+	link, err = ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{Variants: &reweighted})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), link.Version)
+	assert.Equal(t, int64(4), link.Clicks)
+	assert.Equal(t, 90, link.Variants[0].Weight)
+	assert.Equal(t, int64(1), link.Variants[0].Clicks, "счётчики сохраняются при смене весов")
+	assert.Equal(t, int64(3), link.Variants[1].Clicks)
+}
+
+func TestQueryParamsValidation(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	_, err := ss.CreateShortURL(ctx, "https://shop.example/", CreateOptions{QueryConflict: "merge"})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	_, err = ss.CreateShortURL(ctx, "https://shop.example/", CreateOptions{QueryParams: map[string]string{"": "x"}})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	id, err := ss.CreateShortURL(ctx, "https://shop.example/", CreateOptions{
+		UserID:      "owner",
+		QueryParams: map[string]string{"utm_source": "newsletter", "utm_medium": "email"},
+	})
+	require.NoError(t, err)
+
+	campaign, forward := "spring", true
+	link, err := ss.UpdateLink(ctx, id, "owner", 1, LinkPatch{
+		QueryParams:  map[string]*string{"utm_medium": nil, "utm_campaign": &campaign},
+		ForwardQuery: &forward,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"utm_source": "newsletter", "utm_campaign": "spring"}, link.QueryParams)
+	assert.True(t, link.ForwardQuery)
+
+	history, err := ss.LinkHistory(ctx, id, "owner")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, model.FieldChange{Old: "email", New: nil}, history[0].Changes["query_params.utm_medium"])
+	assert.Contains(t, history[0].Changes, "forward_query")
+}
+
+func TestActivationWindow(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository(), WithScreener(hostScreener{"evil.example": true}))
+	now := time.Now()
+	hour := time.Hour
+
+	from, until := now.Add(hour), now.Add(-hour)
+	_, err := ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{ActiveFrom: &from, ActiveUntil: &until})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	_, err = ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{FallbackURL: "https://evil.example/"})
+	assert.ErrorIs(t, err, ErrorBlockedURL)
+	var validation *ValidationError
+	require.ErrorAs(t, err, &validation)
+	assert.Equal(t, "fallback_url", validation.Field)
+
+	scheduled, err := ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{
+		UserID:      "owner",
+		ActiveFrom:  &from,
+		FallbackURL: "https://launch.example/soon",
+	})
+	require.NoError(t, err)
+	_, err = ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{UserID: "owner", ActiveUntil: &until})
+	require.NoError(t, err)
+	active, err := ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{UserID: "owner"})
+	require.NoError(t, err)
+	_, err = ss.CreateShortURL(ctx, "https://launch.example/", CreateOptions{UserID: "someone else"})
+	require.NoError(t, err)
+
+	page, err := ss.ListLinks(ctx, "owner", ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Links, 3)
+
+	page, err = ss.ListLinks(ctx, "owner", ListOptions{State: model.StateScheduled})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	assert.Equal(t, scheduled, page.Links[0].ShortURL)
+
+	page, err = ss.ListLinks(ctx, "owner", ListOptions{State: model.StateActive})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	assert.Equal(t, active, page.Links[0].ShortURL)
+
+	_, err = ss.ListLinks(ctx, "owner", ListOptions{State: "paused"})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	// Окно проверяется целиком, с учётом уже сохранённой границы.
+	_, err = ss.UpdateLink(ctx, scheduled, "owner", 1, LinkPatch{ActiveUntil: &until})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	empty := ""
+	link, err := ss.UpdateLink(ctx, scheduled, "owner", 1, LinkPatch{ClearActiveFrom: true, FallbackURL: &empty})
+	require.NoError(t, err)
+	assert.Nil(t, link.ActiveFrom)
+	assert.Empty(t, link.FallbackURL)
+	assert.Equal(t, model.StateActive, link.State(time.Now()))
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	_, _, err := ss.CreateAPIKey(ctx, "owner", "ci", []string{"links:delete"}, nil)
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	past := time.Now().Add(-time.Minute)
+	_, _, err = ss.CreateAPIKey(ctx, "owner", "ci", []string{auth.ScopeLinksRead}, &past)
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	key, token, err := ss.CreateAPIKey(ctx, "owner", "ci", []string{auth.ScopeLinksWrite, auth.ScopeLinksRead, auth.ScopeLinksWrite}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.ScopeLinksRead, auth.ScopeLinksWrite}, key.Scopes)
+	assert.NotContains(t, key.Hash, token)
+
+	authenticated, err := ss.AuthenticateAPIKey(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "owner", authenticated.UserID)
+
+	_, err = ss.AuthenticateAPIKey(ctx, token+"x")
+	assert.ErrorIs(t, err, ErrorInvalidAPIKey)
+
+	assert.ErrorIs(t, ss.RevokeAPIKey(ctx, "intruder", key.ID), ErrorAPIKeyNotFound)
+	require.NoError(t, ss.RevokeAPIKey(ctx, "owner", key.ID))
+
+	_, err = ss.AuthenticateAPIKey(ctx, token)
+	assert.ErrorIs(t, err, ErrorInvalidAPIKey)
+
+	keys, err := ss.ListAPIKeys(ctx, "owner")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
+
+func TestAdminOperations(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	first, err := ss.CreateShortURL(ctx, "https://example.com/1", CreateOptions{UserID: "u1"})
+	require.NoError(t, err)
+	_, err = ss.CreateShortURL(ctx, "https://example.com/2", CreateOptions{UserID: "u1"})
+	require.NoError(t, err)
+	other, err := ss.CreateShortURL(ctx, "https://example.com/3", CreateOptions{UserID: "u2"})
+	require.NoError(t, err)
+
+	totals, err := ss.Totals(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Totals{URLs: 3, Users: 2}, totals)
+
+	link, err := ss.SetLinkDisabled(ctx, other, true, "")
+	require.NoError(t, err)
+	assert.True(t, link.Disabled)
+	assert.Equal(t, model.DisabledByAdmin, link.DisabledReason)
+
+	link, err = ss.SetLinkDisabled(ctx, other, false, "ignored")
+	require.NoError(t, err)
+	assert.False(t, link.Disabled)
+	assert.Empty(t, link.DisabledReason)
+
+	_, err = ss.SetLinkDisabled(ctx, "missing", true, "")
+	assert.ErrorIs(t, err, repository.ErrorNotFound)
+
+	_, err = ss.DeleteUserLinks(ctx, "")
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	deleted, err := ss.DeleteUserLinks(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	deleted, err = ss.DeleteUserLinks(ctx, "u1")
+	require.NoError(t, err)
+	assert.Zero(t, deleted, "повторное удаление ничего не меняет")
+
+	_, err = ss.GetLink(ctx, first)
+	assert.ErrorIs(t, err, repository.ErrorGone)
+	_, err = ss.RegisterClick(ctx, first, "")
+	assert.ErrorIs(t, err, repository.ErrorGone)
+	_, err = ss.UpdateLink(ctx, first, "u1", 1, LinkPatch{})
+	assert.ErrorIs(t, err, repository.ErrorGone)
+
+	link, err = ss.LookupLink(ctx, first)
+	require.NoError(t, err)
+	assert.NotNil(t, link.DeletedAt)
+
+	page, err := ss.ListLinks(ctx, "u1", ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Links)
+
+	page, err = ss.ListLinks(ctx, "u1", ListOptions{State: model.StateDeleted})
+	require.NoError(t, err)
+	assert.Len(t, page.Links, 2)
+
+	totals, err = ss.Totals(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Totals{URLs: 1, Users: 1}, totals)
+}
+
+func TestAliasAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	id, err := ss.CreateShortURL(ctx, "https://example.com", CreateOptions{UserID: "owner", Alias: "spring_24"})
+	require.NoError(t, err)
+	assert.Equal(t, "spring_24", id)
+
+	_, err = ss.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: "spring_24"})
+	assert.ErrorIs(t, err, repository.ErrorAlreadyExists)
+
+	for _, alias := range []string{"ab", "way-too-long-alias", "with space", "a/b", "API", "dashboard"} {
+		_, err := ss.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: alias})
+		assert.ErrorIs(t, err, ErrorInvalidOptions, alias)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	_, err = ss.CreateShortURL(ctx, "https://example.com", CreateOptions{ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+	future := time.Now().Add(time.Hour)
+	id, err = ss.CreateShortURL(ctx, "https://example.com", CreateOptions{ExpiresAt: &future})
+	require.NoError(t, err)
+	link, err := ss.GetLink(ctx, id)
+	require.NoError(t, err)
+	require.NotNil(t, link.ExpiresAt)
+	assert.True(t, link.ExpiresAt.Equal(future))
+}
+
+func TestDeleteLink(t *testing.T) {
+	ctx := context.Background()
+	ss := NewShortenerService(repository.NewMemoryRepository())
+
+	id, err := ss.CreateShortURL(ctx, "https://example.com", CreateOptions{UserID: "owner"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, ss.DeleteLink(ctx, id, "intruder"), ErrorForbidden)
+	assert.ErrorIs(t, ss.DeleteLink(ctx, "missing", "owner"), repository.ErrorNotFound)
+	require.NoError(t, ss.DeleteLink(ctx, id, "owner"))
+	assert.ErrorIs(t, ss.DeleteLink(ctx, id, "owner"), repository.ErrorGone)
+
+	_, err = ss.GetLink(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrorGone)
+}
+
+func TestListLinksPagination(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	path := t.TempDir() + "/urls.json"
+
+	seed := func(t *testing.T, repo repository.URLRepository) {
+		for i, host := range []string{"a.example", "go.a.example", "b.example", "a.example", "b.example"} {
+			require.NoError(t, repo.Save(ctx, model.URLModel{
+				ShortURL:    fmt.Sprintf("l%d", i),
+				OriginalURL: "https://" + host + "/page",
+				UserID:      "owner",
+				CreatedAt:   base.Add(time.Duration(i) * time.Hour),
+				// Одинаковое число переходов у l1 и l2 упорядочивается по идентификатору.
+				Clicks:  []int64{5, 1, 1, 9, 0}[i],
+				Version: 1,
+			}))
+		}
+		require.NoError(t, repo.Save(ctx, model.URLModel{ShortURL: "x", OriginalURL: "https://a.example/", UserID: "other", CreatedAt: base, Version: 1}))
+	}
+
+	file, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+	seed(t, file)
+	reopened, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+	memory := repository.NewMemoryRepository()
+	seed(t, memory)
+
+	ids := func(links []model.URLModel) []string {
+		result := make([]string, 0, len(links))
+		for _, link := range links {
+			result = append(result, link.ShortURL)
+		}
+		return result
+	}
+	// all собирает выдачу целиком, проходя по курсорам страницами по две ссылки.
+	all := func(t *testing.T, ss *ShortenerService, opts ListOptions) []string {
+		var result []string
+		opts.Limit = 2
+		for range 10 {
+			page, err := ss.ListLinks(ctx, "owner", opts)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Links), 2)
+			result = append(result, ids(page.Links)...)
+			if page.NextCursor == "" {
+				return result
+			}
+			opts.Cursor = page.NextCursor
+		}
+		t.Fatal("pagination does not terminate")
+		return nil
+	}
+
+	for name, repo := range map[string]repository.URLRepository{"memory": memory, "file": reopened} {
+		t.Run(name, func(t *testing.T) {
+			ss := NewShortenerService(repo)
+
+			assert.Equal(t, []string{"l4", "l3", "l2", "l1", "l0"}, all(t, ss, ListOptions{}))
+			assert.Equal(t, []string{"l0", "l1", "l2", "l3", "l4"}, all(t, ss, ListOptions{Order: OrderAsc}))
+			assert.Equal(t, []string{"l3", "l0", "l2", "l1", "l4"}, all(t, ss, ListOptions{Sort: repository.SortClicks}))
+			assert.Equal(t, []string{"l4", "l1", "l2", "l0", "l3"}, all(t, ss, ListOptions{Sort: repository.SortClicks, Order: OrderAsc}))
+
+			assert.Equal(t, []string{"l3", "l1", "l0"}, all(t, ss, ListOptions{Domain: "A.example."}))
+			assert.Equal(t, []string{"l1"}, all(t, ss, ListOptions{Domain: "go.a.example"}))
+			assert.Equal(t, []string{"l4", "l2"}, all(t, ss, ListOptions{Search: " B.EXAMPLE "}))
+			assert.Equal(t, []string{"l3"}, all(t, ss, ListOptions{Search: "L3"}))
+
+			from, to := base.Add(time.Hour), base.Add(3*time.Hour)
+			assert.Equal(t, []string{"l2", "l1"}, all(t, ss, ListOptions{CreatedFrom: &from, CreatedTo: &to}))
+
+			// Переход сдвигает ссылку в порядке по переходам.
+			_, err := ss.RegisterClick(ctx, "l4", "")
+			require.NoError(t, err)
+			_, err = ss.RegisterClick(ctx, "l4", "")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"l3", "l0", "l4", "l2", "l1"}, all(t, ss, ListOptions{Sort: repository.SortClicks}))
+
+			page, err := ss.ListLinks(ctx, "owner", ListOptions{Limit: 2})
+			require.NoError(t, err)
+			_, err = ss.ListLinks(ctx, "owner", ListOptions{Limit: 2, Cursor: page.NextCursor, Order: OrderAsc})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+			_, err = ss.ListLinks(ctx, "owner", ListOptions{Cursor: "not a cursor"})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+			_, err = ss.ListLinks(ctx, "owner", ListOptions{Sort: "name"})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+			_, err = ss.ListLinks(ctx, "owner", ListOptions{CreatedFrom: &to, CreatedTo: &from})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/urls.json"
+	file, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+
+	for name, repo := range map[string]repository.URLRepository{"memory": repository.NewMemoryRepository(), "file": file} {
+		t.Run(name, func(t *testing.T) {
+			ss := NewShortenerService(repo)
+
+			first, err := ss.CreateShortURL(ctx, "https://example.com/1", CreateOptions{UserID: "owner", Tags: []string{"Promo", " promo ", "spring"}})
+			require.NoError(t, err)
+			second, err := ss.CreateShortURL(ctx, "https://example.com/2", CreateOptions{UserID: "owner"})
+			require.NoError(t, err)
+			third, err := ss.CreateShortURL(ctx, "https://example.com/3", CreateOptions{UserID: "owner", Tags: []string{"promo"}})
+			require.NoError(t, err)
+			_, err = ss.CreateShortURL(ctx, "https://example.com/4", CreateOptions{UserID: "other", Tags: []string{"promo"}})
+			require.NoError(t, err)
+
+			_, err = ss.CreateShortURL(ctx, "https://example.com/5", CreateOptions{UserID: "owner", Tags: []string{"no spaces"}})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+			_, err = ss.CreateShortURL(ctx, "https://example.com/5", CreateOptions{Tags: []string{"promo"}})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+			link, err := ss.GetLink(ctx, first)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"promo", "spring"}, link.Tags)
+
+			link, err = ss.AddTags(ctx, second, "owner", []string{"Весна", "spring"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"spring", "весна"}, link.Tags)
+			assert.Equal(t, int64(1), link.Version)
+
+			_, err = ss.AddTags(ctx, second, "other", []string{"mine"})
+			assert.ErrorIs(t, err, ErrorForbidden)
+			_, err = ss.AddTags(ctx, second, "owner", nil)
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+			many := make([]string, maxTags-1)
+			for i := range many {
+				many[i] = fmt.Sprintf("t%d", i)
+			}
+			_, err = ss.AddTags(ctx, second, "owner", many)
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+			// Правка ссылки не теряет метки, добавленные в обход версии.
+			moved := "https://example.com/2b"
+			link, err = ss.UpdateLink(ctx, second, "owner", 1, LinkPatch{OriginalURL: &moved})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"spring", "весна"}, link.Tags)
+
+			link, err = ss.RemoveTags(ctx, second, "owner", []string{"ВЕСНА", "missing"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"spring"}, link.Tags)
+
+			page, err := ss.ListLinks(ctx, "owner", ListOptions{Tag: "Spring", Order: OrderAsc})
+			require.NoError(t, err)
+			assert.Len(t, page.Links, 2)
+			assert.Equal(t, first, page.Links[0].ShortURL)
+			_, err = ss.ListLinks(ctx, "owner", ListOptions{Tag: "#spring"})
+			assert.ErrorIs(t, err, ErrorInvalidOptions)
+
+			for range 3 {
+				_, err = ss.RegisterClick(ctx, first, "")
+				require.NoError(t, err)
+			}
+			_, err = ss.RegisterClick(ctx, third, "")
+			require.NoError(t, err)
+
+			tags, err := ss.ListTags(ctx, "owner")
+			require.NoError(t, err)
+			assert.Equal(t, []repository.TagStats{
+				{Tag: "promo", Links: 2, Clicks: 4},
+				{Tag: "spring", Links: 2, Clicks: 3},
+			}, tags)
+
+			require.NoError(t, ss.DeleteLink(ctx, third, "owner"))
+			stats, err := ss.TagStats(ctx, "owner", "PROMO")
+			require.NoError(t, err)
+			assert.Equal(t, repository.TagStats{Tag: "promo", Links: 1, Clicks: 3}, stats)
+
+			_, err = ss.TagStats(ctx, "owner", "весна")
+			assert.ErrorIs(t, err, ErrorTagNotFound)
+			_, err = ss.ListTags(ctx, "")
+			assert.ErrorIs(t, err, ErrorForbidden)
+		})
+	}
+
+	require.NoError(t, file.Close())
+	reopened, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+	tags, err := NewShortenerService(reopened).ListTags(ctx, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, []repository.TagStats{{Tag: "promo", Links: 1, Clicks: 3}, {Tag: "spring", Links: 2, Clicks: 3}}, tags)
+}
+
+func TestFileRepositoryClicks(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/urls.json"
+	file, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+	ss := NewShortenerService(file)
+
+	plain, err := ss.CreateShortURL(ctx, "https://example.com/plain", CreateOptions{})
+	require.NoError(t, err)
+	limited, err := ss.CreateShortURL(ctx, "https://example.com/limited", CreateOptions{MaxClicks: 10})
+	require.NoError(t, err)
+
+	for range 5 {
+		_, err = ss.RegisterClick(ctx, plain, "")
+		require.NoError(t, err)
+		_, err = ss.RegisterClick(ctx, limited, "")
+		require.NoError(t, err)
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// Две записи при создании и по строке на каждый переход по ссылке с
+	// лимитом; переходы без лимита дописывает фоновый сброс или Close.
+	assert.Equal(t, 2+5, strings.Count(string(data), "\n"), "переходы без лимита пишутся пачкой")
+
+	require.NoError(t, file.Close())
+	reopened, err := repository.NewFileRepository(path)
+	require.NoError(t, err)
+	for id, clicks := range map[string]int64{plain: 5, limited: 5} {
+		link, err := reopened.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, clicks, link.Clicks, id)
+	}
+}
+
+func TestAddTagsConcurrentLimit(t *testing.T) {
+	ctx := context.Background()
+	file, err := repository.NewFileRepository(t.TempDir() + "/urls.json")
+	require.NoError(t, err)
+
+	for name, repo := range map[string]repository.URLRepository{"memory": repository.NewMemoryRepository(), "file": file} {
+		t.Run(name, func(t *testing.T) {
+			ss := NewShortenerService(repo)
+			id, err := ss.CreateShortURL(ctx, "https://example.com/", CreateOptions{UserID: "owner"})
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			var rejected atomic.Int32
+			for i := range maxTags + 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := ss.AddTags(ctx, id, "owner", []string{fmt.Sprintf("t%d", i)}); err != nil {
+						assert.ErrorIs(t, err, ErrorInvalidOptions)
+						rejected.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			link, err := ss.GetLink(ctx, id)
+			require.NoError(t, err)
+			assert.Len(t, link.Tags, maxTags)
+			assert.Equal(t, int32(10), rejected.Load())
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxTags ограничивает число меток на одной ссылке.
+const maxTags = 20
+
+// Метка — до 32 букв, цифр, '-' или '_', начиная с буквы или цифры.
+// Регистр не различается: метки хранятся в нижнем регистре.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_-]{0,31}$`)
+
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(tag) {
+		return "", invalidOption("tags", "tag %q must be 1-32 letters, digits, '-' or '_'", tag)
+	}
+	return tag, nil
+}
+
+// normalizeTags приводит метки к нижнему регистру, проверяет их и убирает
+// повторы. Результат отсортирован.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxTags {
+		return nil, invalidOption("tags", "a link may have at most %d tags", maxTags)
+	}
+	return normalized, nil
+}
+
+// AddTags добавляет метки ссылке владельца userID и возвращает её. Метки не
+// меняют версию ссылки и не пишутся в историю изменений.
+func (ss *ShortenerService) AddTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.AddTags")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	if _, err := ss.ownedLink(ctx, id, userID); err != nil {
+		return model.URLModel{}, err
+	}
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	if len(tags) == 0 {
+		return model.URLModel{}, invalidOption("tags", "must not be empty")
+	}
+
+	// Лимит проверяет хранилище: проверка здесь не учла бы метки,
+	// добавленные параллельным запросом.
+	if err := ss.repo.AddTags(ctx, id, tags, maxTags); err != nil {
+		if errors.Is(err, repository.ErrorTooManyTags) {
+			return model.URLModel{}, invalidOption("tags", "a link may have at most %d tags", maxTags)
+		}
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+
+	logger.FromContext(ctx).Debug("Ссылке добавлены метки", zap.String("id", id), zap.Strings("tags", tags))
+	return ss.repo.Get(ctx, id)
+}
+
+// RemoveTags снимает метки со ссылки владельца userID и возвращает её.
+// Отсутствующие на ссылке метки пропускаются.
+func (ss *ShortenerService) RemoveTags(ctx context.Context, id, userID string, tags []string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.RemoveTags")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.ownedLink(ctx, id, userID)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	if !slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(link.Tags, tag) }) {
+		return link, nil
+	}
+
+	if err := ss.repo.RemoveTags(ctx, id, tags); err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+
+	logger.FromContext(ctx).Debug("Со ссылки сняты метки", zap.String("id", id), zap.Strings("tags", tags))
+	return ss.repo.Get(ctx, id)
+}
+
+// ListTags возвращает метки пользователя с числом ссылок и переходов.
+func (ss *ShortenerService) ListTags(ctx context.Context, userID string) ([]repository.TagStats, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.ListTags")
+	defer span.End()
+
+	if userID == "" {
+		return nil, ErrorForbidden
+	}
+
+	tags, err := ss.repo.Tags(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return tags, nil
+}
+
+// TagStats возвращает переходы по метке, просуммированные по всем её
+// неудалённым ссылкам.
+func (ss *ShortenerService) TagStats(ctx context.Context, userID, tag string) (repository.TagStats, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.TagStats")
+	defer span.End()
+
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return repository.TagStats{}, err
+	}
+	tags, err := ss.ListTags(ctx, userID)
+	if err != nil {
+		return repository.TagStats{}, err
+	}
+
+	i := slices.IndexFunc(tags, func(stats repository.TagStats) bool {
+		return stats.Tag == tag
+	})
+	if i < 0 {
+		return repository.TagStats{}, ErrorTagNotFound
+	}
+	return tags[i], nil
+}
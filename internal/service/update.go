@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/logger"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"reflect"
+	"time"
+)
+
+// LinkPatch описывает частичное изменение ссылки. Nil-поля не меняются;
+// ClearExpiry снимает срок действия, а nil-значение в Metadata удаляет ключ.
+type LinkPatch struct {
+	OriginalURL  *string
+	ExpiresAt    *time.Time
+	ClearExpiry  bool
+	Metadata     map[string]*string
+	Interstitial *bool
+	RedirectType *string
+	Rules        *[]model.Rule
+	Variants     *[]model.Variant
+	// QueryParams, как и Metadata, сливается с текущими шаблонами параметров.
+	QueryParams   map[string]*string
+	QueryConflict *string
+	ForwardQuery  *bool
+	// Окно активности задаётся и снимается так же, как срок действия;
+	// пустой FallbackURL убирает запасной адрес.
+	ActiveFrom       *time.Time
+	ClearActiveFrom  bool
+	ActiveUntil      *time.Time
+	ClearActiveUntil bool
+	FallbackURL      *string
+}
+
+// AnyVersion вместо версии в UpdateLink применяет patch к текущей версии
+// ссылки, как If-Match: *.
+const AnyVersion int64 = -1
+
+// UpdateLink применяет patch к ссылке владельца userID. version — версия,
+// которую видел клиент; если ссылку успели изменить, возвращается
+// repository.ErrorConflict. Пустой patch версию не увеличивает.
+func (ss *ShortenerService) UpdateLink(ctx context.Context, id, userID string, version int64, patch LinkPatch) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.UpdateLink")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	link, err := ss.ownedLink(ctx, id, userID)
+	if err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+	if version != AnyVersion && link.Version != version {
+		return model.URLModel{}, repository.ErrorConflict
+	}
+
+	updated, changes, err := ss.applyPatch(ctx, link, patch)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	if len(changes) == 0 {
+		return link, nil
+	}
+
+	updated.Version = link.Version + 1
+	entry := model.HistoryEntry{
+		ShortURL:  id,
+		Version:   updated.Version,
+		ChangedAt: time.Now().UTC(),
+		ChangedBy: userID,
+		Changes:   changes,
+	}
+	if err := ss.repo.Update(ctx, updated, entry); err != nil {
+		span.RecordError(err)
+		return model.URLModel{}, err
+	}
+
+	logger.FromContext(ctx).Info("Ссылка изменена", zap.String("id", id), zap.Int64("version", updated.Version))
+	return updated, nil
+}
+
+func (ss *ShortenerService) LinkHistory(ctx context.Context, id, userID string) ([]model.HistoryEntry, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.LinkHistory")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	if _, err := ss.ownedLink(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	return ss.repo.History(ctx, id)
+}
+
+// LinkStats возвращает ссылку владельца userID для отчёта о переходах.
+// Статистика чужих ссылок не раскрывается.
+func (ss *ShortenerService) LinkStats(ctx context.Context, id, userID string) (model.URLModel, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.LinkStats")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	return ss.ownedLink(ctx, id, userID)
+}
+
+// DeleteLink помечает удалённой ссылку владельца userID. Переходы по ней
+// после этого отвечают 410.
+func (ss *ShortenerService) DeleteLink(ctx context.Context, id, userID string) error {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ShortenerService.DeleteLink")
+	defer span.End()
+	span.SetAttributes(attribute.String("shortener.id", id))
+
+	if _, err := ss.ownedLink(ctx, id, userID); err != nil {
+		return err
+	}
+	if err := ss.repo.Delete(ctx, id, time.Now().UTC()); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	logger.FromContext(ctx).Info("Ссылка удалена", zap.String("id", id))
+	return nil
+}
+
+// ownedLink возвращает ссылку, если она принадлежит userID. Ссылки без
+// владельца, созданные до появления авторизации, не может менять никто;
+// удалённые ссылки не меняются вовсе.
+func (ss *ShortenerService) ownedLink(ctx context.Context, id, userID string) (model.URLModel, error) {
+	link, err := ss.repo.Get(ctx, id)
+	if err != nil {
+		return model.URLModel{}, err
+	}
+	if link.UserID == "" || link.UserID != userID {
+		return model.URLModel{}, ErrorForbidden
+	}
+	if link.Deleted() {
+		return model.URLModel{}, repository.ErrorGone
+	}
+	return link, nil
+}
+
+func (ss *ShortenerService) applyPatch(ctx context.Context, link model.URLModel, patch LinkPatch) (model.URLModel, map[string]model.FieldChange, error) {
+	changes := make(map[string]model.FieldChange)
+
+	if patch.OriginalURL != nil {
+		originalURL, err := ss.checkDestination(ctx, *patch.OriginalURL)
+		if err != nil {
+			return link, nil, err
+		}
+		if originalURL != link.OriginalURL {
+			changes["original_url"] = model.FieldChange{Old: link.OriginalURL, New: originalURL}
+			link.OriginalURL = originalURL
+		}
+	}
+
+	if patch.ExpiresAt != nil && !patch.ExpiresAt.After(time.Now()) {
+		return link, nil, invalidOption("expires_at", "must be in the future")
+	}
+	var err error
+	if link.ExpiresAt, err = patchTime("expires_at", link.ExpiresAt, patch.ExpiresAt, patch.ClearExpiry, changes); err != nil {
+		return link, nil, err
+	}
+	if link.ActiveFrom, err = patchTime("active_from", link.ActiveFrom, patch.ActiveFrom, patch.ClearActiveFrom, changes); err != nil {
+		return link, nil, err
+	}
+	if link.ActiveUntil, err = patchTime("active_until", link.ActiveUntil, patch.ActiveUntil, patch.ClearActiveUntil, changes); err != nil {
+		return link, nil, err
+	}
+	if err := checkWindow(link.ActiveFrom, link.ActiveUntil); err != nil {
+		return link, nil, err
+	}
+
+	if patch.FallbackURL != nil {
+		fallbackURL := *patch.FallbackURL
+		if fallbackURL != "" {
+			if fallbackURL, err = ss.checkDestination(ctx, fallbackURL); err != nil {
+				return link, nil, inField(err, "fallback_url")
+			}
+		}
+		if fallbackURL != link.FallbackURL {
+			changes["fallback_url"] = model.FieldChange{Old: link.FallbackURL, New: fallbackURL}
+			link.FallbackURL = fallbackURL
+		}
+	}
+
+	if patch.Interstitial != nil && *patch.Interstitial != link.Interstitial {
+		changes["interstitial"] = model.FieldChange{Old: link.Interstitial, New: *patch.Interstitial}
+		link.Interstitial = *patch.Interstitial
+	}
+
+	if patch.RedirectType != nil && *patch.RedirectType != link.RedirectType {
+		if *patch.RedirectType != "" && !model.ValidRedirectType(*patch.RedirectType) {
+			return link, nil, invalidOption("redirect_type", "unknown value %q", *patch.RedirectType)
+		}
+		changes["redirect_type"] = model.FieldChange{Old: link.RedirectType, New: *patch.RedirectType}
+		link.RedirectType = *patch.RedirectType
+	}
+
+	if patch.Rules != nil {
+		routing, err := ss.checkRules(ctx, *patch.Rules)
+		if err != nil {
+			return link, nil, err
+		}
+		if !reflect.DeepEqual(routing, link.Rules) {
+			changes["rules"] = model.FieldChange{Old: link.Rules, New: routing}
+			link.Rules = routing
+		}
+	}
+
+	if patch.Variants != nil {
+		variants, err := ss.checkVariants(ctx, *patch.Variants)
+		if err != nil {
+			return link, nil, err
+		}
+		if old := withoutClicks(link.Variants); !reflect.DeepEqual(variants, old) {
+			changes["variants"] = model.FieldChange{Old: old, New: variants}
+			link.Variants = keepVariantClicks(variants, link.Variants)
+		}
+	}
+
+	if len(patch.Metadata) > 0 {
+		metadata, err := mergeStrings("metadata", link.Metadata, patch.Metadata, changes, metadataLimits)
+		if err != nil {
+			return link, nil, err
+		}
+		link.Metadata = metadata
+	}
+
+	if len(patch.QueryParams) > 0 {
+		params, err := mergeStrings("query_params", link.QueryParams, patch.QueryParams, changes, queryParamLimits)
+		if err != nil {
+			return link, nil, err
+		}
+		link.QueryParams = params
+	}
+
+	if patch.QueryConflict != nil && *patch.QueryConflict != link.QueryConflict {
+		if *patch.QueryConflict != "" && !model.ValidQueryConflict(*patch.QueryConflict) {
+			return link, nil, invalidOption("query_conflict", "unknown value %q", *patch.QueryConflict)
+		}
+		changes["query_conflict"] = model.FieldChange{Old: link.QueryConflict, New: *patch.QueryConflict}
+		link.QueryConflict = *patch.QueryConflict
+	}
+
+	if patch.ForwardQuery != nil && *patch.ForwardQuery != link.ForwardQuery {
+		changes["forward_query"] = model.FieldChange{Old: link.ForwardQuery, New: *patch.ForwardQuery}
+		link.ForwardQuery = *patch.ForwardQuery
+	}
+
+	return link, changes, nil
+}
+
+type mapLimits struct {
+	entries  int
+	keyLen   int
+	valueLen int
+}
+
+var metadataLimits = mapLimits{entries: 32, keyLen: 64, valueLen: 1024}
+
+// mergeStrings применяет patch к словарю current и записывает изменения в
+// changes под ключами "name.key"; nil-значение удаляет ключ. Пустой
+// результат возвращается как nil.
+func mergeStrings(name string, current map[string]string, patch map[string]*string, changes map[string]model.FieldChange, limits mapLimits) (map[string]string, error) {
+	merged := make(map[string]string, len(current)+len(patch))
+	for key, value := range current {
+		merged[key] = value
+	}
+
+	for key, value := range patch {
+		if key == "" || len(key) > limits.keyLen {
+			return nil, invalidOption(name, "keys must be 1-%d bytes", limits.keyLen)
+		}
+		old, existed := merged[key]
+		switch {
+		case value == nil && existed:
+			changes[name+"."+key] = model.FieldChange{Old: old, New: nil}
+			delete(merged, key)
+		case value == nil:
+		case len(*value) > limits.valueLen:
+			return nil, invalidOption(name, "values must not exceed %d bytes", limits.valueLen)
+		case !existed || old != *value:
+			var oldValue any
+			if existed {
+				oldValue = old
+			}
+			changes[name+"."+key] = model.FieldChange{Old: oldValue, New: *value}
+			merged[key] = *value
+		}
+	}
+
+	if len(merged) > limits.entries {
+		return nil, invalidOption(name, "at most %d entries are allowed", limits.entries)
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// patchTime применяет изменение необязательной отметки времени name.
+func patchTime(name string, current, value *time.Time, clear bool, changes map[string]model.FieldChange) (*time.Time, error) {
+	if value != nil && clear {
+		return current, invalidOption(name, "cannot be both set and cleared")
+	}
+	switch {
+	case value != nil:
+		utc := value.UTC()
+		if current == nil || !current.Equal(utc) {
+			changes[name] = model.FieldChange{Old: current, New: utc}
+			return &utc, nil
+		}
+	case clear && current != nil:
+		changes[name] = model.FieldChange{Old: current, New: nil}
+		return nil, nil
+	}
+	return current, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"yclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"_ga":     true,
+}
+
+type URLValidator struct {
+	allowedSchemes map[string]bool
+	stripTracking  bool
+}
+
+func NewURLValidator(allowedSchemes []string, stripTracking bool) *URLValidator {
+	v := &URLValidator{
+		allowedSchemes: make(map[string]bool),
+		stripTracking:  stripTracking,
+	}
+
+	for _, scheme := range allowedSchemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme != "" {
+			v.allowedSchemes[scheme] = true
+		}
+	}
+	return v
+}
+
+func DefaultURLValidator() *URLValidator {
+	return NewURLValidator([]string{"http", "https"}, false)
+}
+
+func invalidURL(format string, args ...any) error {
+	return &ValidationError{Err: ErrorInvalidURL, Message: fmt.Sprintf(format, args...)}
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+func (v *URLValidator) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", invalidURL("URL cannot be empty")
+	}
+
+	if strings.IndexFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "", invalidURL("URL must not contain whitespace or control characters")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", invalidURL("URL could not be parsed")
+	}
+
+	if !u.IsAbs() {
+		return "", invalidURL("URL must be absolute")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !v.allowedSchemes[u.Scheme] {
+		return "", invalidURL("scheme %q is not allowed", u.Scheme)
+	}
+
+	if u.Opaque != "" || u.Host == "" {
+		return "", invalidURL("URL must contain a host")
+	}
+
+	if u.User != nil {
+		return "", invalidURL("credentials in URL are not allowed")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if v.stripTracking && u.RawQuery != "" {
+		query := u.Query()
+		stripped := false
+		for name := range query {
+			if isTrackingParam(name) {
+				query.Del(name)
+				stripped = true
+			}
+		}
+		if stripped {
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	return u.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", invalidURL("URL must contain a host")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", invalidURL("host %q is not a valid domain name", host)
+	}
+	return strings.ToLower(ascii), nil
+}
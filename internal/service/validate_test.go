@@ -0,0 +1,111 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestURLValidatorNormalize(t *testing.T) {
+	type testCase struct {
+		name          string
+		stripTracking bool
+		input         string
+		expected      string
+		expectError   bool
+	}
+
+	tests := []testCase{
+		{
+			name:     "обычный URL",
+			input:    "https://practicum.yandex.ru/learn",
+			expected: "https://practicum.yandex.ru/learn",
+		},
+		{
+			name:     "пробелы и перевод строки по краям",
+			input:    "  https://practicum.yandex.ru/\n",
+			expected: "https://practicum.yandex.ru/",
+		},
+		{
+			name:     "хост и схема в верхнем регистре",
+			input:    "HTTPS://Practicum.Yandex.RU/Path",
+			expected: "https://practicum.yandex.ru/Path",
+		},
+		{
+			name:     "порт по умолчанию удаляется",
+			input:    "http://example.com:80/a",
+			expected: "http://example.com/a",
+		},
+		{
+			name:     "нестандартный порт сохраняется",
+			input:    "https://example.com:8443/a",
+			expected: "https://example.com:8443/a",
+		},
+		{
+			name:     "IDN переводится в punycode",
+			input:    "https://пример.рф/путь",
+			expected: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C",
+		},
+		{
+			name:     "IPv6 с портом по умолчанию",
+			input:    "https://[::1]:443/",
+			expected: "https://[::1]/",
+		},
+		{
+			name:          "трекинговые параметры удаляются",
+			stripTracking: true,
+			input:         "https://example.com/?utm_source=x&id=5&fbclid=abc",
+			expected:      "https://example.com/?id=5",
+		},
+		{
+			name:     "трекинговые параметры сохраняются без флага",
+			input:    "https://example.com/?utm_source=x&id=5",
+			expected: "https://example.com/?utm_source=x&id=5",
+		},
+		{
+			name:        "javascript-схема",
+			input:       "javascript:alert(1)",
+			expectError: true,
+		},
+		{
+			name:        "относительный URL",
+			input:       "/just/a/path",
+			expectError: true,
+		},
+		{
+			name:        "пустая строка",
+			input:       " \n",
+			expectError: true,
+		},
+		{
+			name:        "пробел внутри URL",
+			input:       "https://exa mple.com/",
+			expectError: true,
+		},
+		{
+			name:        "учётные данные в URL",
+			input:       "https://google.com@evil.example/",
+			expectError: true,
+		},
+		{
+			name:        "схема без хоста",
+			input:       "https:///path",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := NewURLValidator([]string{"http", "https"}, test.stripTracking)
+
+			result, err := validator.Normalize(test.input)
+			if test.expectError {
+				require.ErrorIs(t, err, ErrorInvalidURL)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
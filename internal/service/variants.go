@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Guram-Gurych/shortenerURL.git/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxVariants      = 20
+	maxVariantWeight = 10000
+)
+
+var variantIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// checkVariants проверяет варианты A/B-разделения: адреса нормализуются и
+// проходят блок-лист, веса неотрицательны, идентификаторы уникальны.
+// Вариантам без идентификатора назначаются v1, v2 и т. д. Счётчики переходов
+// из запроса игнорируются — их ведёт хранилище.
+func (ss *ShortenerService) checkVariants(ctx context.Context, variants []model.Variant) ([]model.Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	if len(variants) > maxVariants {
+		return nil, invalidOption("variants", "at most %d variants are allowed", maxVariants)
+	}
+
+	seen := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		seen[strings.ToLower(v.ID)] = true
+	}
+
+	checked := make([]model.Variant, 0, len(variants))
+	next := 1
+	for i, v := range variants {
+		v.ID = strings.ToLower(v.ID)
+		if v.ID == "" {
+			for seen["v"+strconv.Itoa(next)] {
+				next++
+			}
+			v.ID = "v" + strconv.Itoa(next)
+			seen[v.ID] = true
+		}
+		if !variantIDPattern.MatchString(v.ID) {
+			return nil, invalidOption(fmt.Sprintf("variants[%d].id", i), "must match %s", variantIDPattern)
+		}
+		for _, c := range checked {
+			if c.ID == v.ID {
+				return nil, invalidOption(fmt.Sprintf("variants[%d].id", i), "duplicate id %q", v.ID)
+			}
+		}
+		if v.Weight < 0 || v.Weight > maxVariantWeight {
+			return nil, invalidOption(fmt.Sprintf("variants[%d].weight", i), "must be between 0 and %d", maxVariantWeight)
+		}
+
+		destination, err := ss.checkDestination(ctx, v.Destination)
+		if err != nil {
+			return nil, inField(err, fmt.Sprintf("variants[%d].destination", i))
+		}
+		v.Destination = destination
+		v.Clicks = 0
+		checked = append(checked, v)
+	}
+
+	return checked, nil
+}
+
+// keepVariantClicks переносит счётчики из прежних вариантов с теми же
+// идентификаторами, чтобы смена весов не обнуляла статистику.
+func keepVariantClicks(variants, previous []model.Variant) []model.Variant {
+	clicks := make(map[string]int64, len(previous))
+	for _, v := range previous {
+		clicks[v.ID] = v.Clicks
+	}
+	kept := make([]model.Variant, len(variants))
+	for i, v := range variants {
+		v.Clicks = clicks[v.ID]
+		kept[i] = v
+	}
+	return kept
+}
+
+// withoutClicks возвращает варианты без счётчиков — для сравнения и истории.
+func withoutClicks(variants []model.Variant) []model.Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	stripped := make([]model.Variant, len(variants))
+	for i, v := range variants {
+		v.Clicks = 0
+		stripped[i] = v
+	}
+	return stripped
+}